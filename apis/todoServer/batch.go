@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	opAdd      = "add"
+	opComplete = "complete"
+	opUpdate   = "update"
+	opDelete   = "delete"
+)
+
+type batchOperation struct {
+	Op   string `json:"op"`
+	ID   int    `json:"id"`
+	Task string `json:"task"`
+}
+
+type batchResult struct {
+	Op     string `json:"op"`
+	ID     int    `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult
+	Applied bool
+}
+
+func (r *batchResponse) MarshalJSON() ([]byte, error) {
+	resp := struct {
+		Results      []batchResult `json:"results"`
+		Applied      bool          `json:"applied"`
+		Date         int64         `json:"date"`
+		TotalResults int           `json:"total_results"`
+	}{
+		Results:      r.Results,
+		Applied:      r.Applied,
+		Date:         time.Now().Unix(),
+		TotalResults: len(r.Results),
+	}
+	return json.Marshal(resp)
+}
+
+func batchHandler(w http.ResponseWriter, r *http.Request, svc *todoService) {
+	batch := struct {
+		Operations []batchOperation `json:"operations"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		replyDecodeError(w, r, err)
+		return
+	}
+
+	outcomes, applied, err := svc.Batch(batch.Operations)
+	if err != nil {
+		replyServiceError(w, r, err)
+		return
+	}
+
+	resp := &batchResponse{
+		Results: make([]batchResult, len(outcomes)),
+		Applied: applied,
+	}
+	for i, o := range outcomes {
+		resp.Results[i] = batchResult{
+			Op:     o.Op,
+			ID:     o.ID,
+			Status: batchStatus(o, applied),
+		}
+		if o.Err != nil {
+			resp.Results[i].Error = o.Err.Error()
+		}
+	}
+
+	if !applied {
+		replyJSONContent(w, r, http.StatusBadRequest, resp)
+		return
+	}
+	replyJSONContent(w, r, http.StatusOK, resp)
+}
+
+// batchStatus returns the HTTP status matching the outcome of an operation,
+// valid operations of a rejected batch failing on the invalid ones
+func batchStatus(o batchOutcome, applied bool) int {
+	switch {
+	case o.Err != nil:
+		return errorStatus(o.Err)
+	case !applied:
+		return http.StatusFailedDependency
+	case o.Op == opAdd:
+		return http.StatusCreated
+	default:
+		return http.StatusNoContent
+	}
+}
+
+// errorStatus returns the HTTP status matching a service error
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidData):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
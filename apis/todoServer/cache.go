@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// setCacheHeaders sets the ETag and Last-Modified headers of the response and
+// reports whether the client copy is still fresh according to the
+// If-None-Match or If-Modified-Since request headers
+func setCacheHeaders(w http.ResponseWriter, r *http.Request, etag string, todoFile string) bool {
+	w.Header().Set("ETag", etag)
+
+	var modTime time.Time
+	if fi, err := os.Stat(todoFile); err == nil {
+		modTime = fi.ModTime().UTC().Truncate(time.Second)
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 7232)
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.After(t)
+	}
+
+	return false
+}
+
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
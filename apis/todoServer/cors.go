@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// corsMethods are the methods browsers are allowed to use cross-origin
+	corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete}
+	// corsHeaders are the request headers browsers are allowed to send
+	corsHeaders = []string{"Accept", "Authorization", "Content-Type",
+		"If-Modified-Since", "If-None-Match", "Last-Event-ID"}
+	// corsExposedHeaders are the response headers scripts are allowed to read
+	corsExposedHeaders = []string{"ETag", "Last-Modified", "Link", "Retry-After"}
+	// corsMaxAge is the number of seconds browsers can cache a preflight
+	corsMaxAge = 600
+)
+
+// corsPolicy lets browser apps served from the allowed origins call the API
+type corsPolicy struct {
+	origins map[string]bool
+	any     bool
+}
+
+// newCORSPolicy returns the policy allowing the comma separated origins, "*"
+// allowing any origin
+func newCORSPolicy(origins string) *corsPolicy {
+	c := &corsPolicy{origins: make(map[string]bool)}
+	for _, o := range strings.Split(origins, ",") {
+		o = strings.TrimSuffix(strings.TrimSpace(o), "/")
+		switch o {
+		case "":
+		case "*":
+			c.any = true
+		default:
+			c.origins[strings.ToLower(o)] = true
+		}
+	}
+	return c
+}
+
+func (c *corsPolicy) allowed(origin string) bool {
+	return c.any || c.origins[strings.ToLower(origin)]
+}
+
+// middleware adds the CORS headers to the responses to allowed origins and
+// answers their preflight requests. Requests from other origins go through
+// without CORS headers, leaving the browser to block them.
+func (c *corsPolicy) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions &&
+			r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !c.allowed(origin) {
+			if preflight {
+				replyError(w, r, http.StatusForbidden, "Origin not allowed: "+origin)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !contains(corsMethods, r.Header.Get("Access-Control-Request-Method")) {
+			replyError(w, r, http.StatusMethodNotAllowed, "Method not allowed cross-origin")
+			return
+		}
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if h = strings.TrimSpace(h); h != "" && !contains(corsHeaders, http.CanonicalHeaderKey(h)) {
+				replyError(w, r, http.StatusForbidden, "Header not allowed cross-origin: "+h)
+				return
+			}
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsHeaders, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	eventAdd      = "add"
+	eventComplete = "complete"
+	eventUpdate   = "update"
+	eventDelete   = "delete"
+	// eventReload tells clients the list changed outside of the API and
+	// should be fetched again
+	eventReload = "reload"
+)
+
+var (
+	// eventHistorySize is the number of past events kept for reconnecting
+	// clients
+	eventHistorySize = 100
+	// watchInterval is how often the todo file is checked for external edits
+	watchInterval = time.Second
+	// eventStreamTimeout ends a stream before the server WriteTimeout hits,
+	// clients then reconnect with their Last-Event-ID
+	eventStreamTimeout = 9 * time.Second
+)
+
+type event struct {
+	ID   uint64 `json:"-"`
+	Type string `json:"type"`
+	Item int    `json:"item,omitempty"`
+	Task string `json:"task,omitempty"`
+	Date int64  `json:"date"`
+}
+
+// broker fans out todo change events to the subscribed event streams and
+// watches the todo file for external edits while streams are open
+type broker struct {
+	todoFile string
+	l        sync.Locker
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastID   uint64
+	history  []event
+	subs     map[chan event]struct{}
+	stop     chan struct{}
+	fileHash [sha256.Size]byte
+}
+
+func newBroker(todoFile string, l sync.Locker) *broker {
+	return &broker{
+		todoFile: todoFile,
+		l:        l,
+		interval: watchInterval,
+		subs:     make(map[chan event]struct{}),
+	}
+}
+
+// publish records the event and sends it to every subscriber. Subscribers
+// too slow to keep up are dropped, they catch up by reconnecting.
+func (b *broker) publish(typ string, item int, task string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	ev := event{
+		ID:   b.lastID,
+		Type: typ,
+		Item: item,
+		Task: task,
+		Date: time.Now().Unix(),
+	}
+
+	b.history = append(b.history, ev)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns a channel of new events and the backlog of events
+// following lastID. If lastID fell out of the history, or is beyond the last
+// event as it comes from before a server restart, the backlog is a single
+// reload event.
+func (b *broker) subscribe(lastID uint64) (chan event, []event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []event
+	switch {
+	case lastID > b.lastID:
+		backlog = []event{{ID: b.lastID, Type: eventReload, Date: time.Now().Unix()}}
+	case lastID > 0 && lastID < b.lastID:
+		if len(b.history) > 0 && b.history[0].ID > lastID+1 {
+			backlog = []event{{ID: b.lastID, Type: eventReload, Date: time.Now().Unix()}}
+		} else {
+			for _, ev := range b.history {
+				if ev.ID > lastID {
+					backlog = append(backlog, ev)
+				}
+			}
+		}
+	}
+
+	ch := make(chan event, 16)
+	b.subs[ch] = struct{}{}
+	if b.stop == nil {
+		b.stop = make(chan struct{})
+		go b.watch(b.stop)
+	}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+		if len(b.subs) == 0 && b.stop != nil {
+			close(b.stop)
+			b.stop = nil
+		}
+	}
+	return ch, backlog, cancel
+}
+
+// watch polls the todo file and publishes a reload event when its content
+// changed without going through the API
+func (b *broker) watch(stop chan struct{}) {
+	b.l.Lock()
+	b.track()
+	b.l.Unlock()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			b.l.Lock()
+			prev := b.hash()
+			b.track()
+			if b.hash() != prev {
+				b.publish(eventReload, 0, "")
+			}
+			b.l.Unlock()
+		}
+	}
+}
+
+// track records the current todo file content as known while the file is
+// being watched. Callers must hold the todo file lock.
+func (b *broker) track() {
+	b.mu.Lock()
+	watching := b.stop != nil
+	b.mu.Unlock()
+	if !watching {
+		return
+	}
+
+	content, err := os.ReadFile(b.todoFile)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fileHash = sha256.Sum256(content)
+}
+
+func (b *broker) hash() [sha256.Size]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.fileHash
+}
+
+func eventsHandler(svc *todoService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			message := "Method not supported"
+			replyError(w, r, http.StatusMethodNotAllowed, message)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			message := "Streaming not supported"
+			replyError(w, r, http.StatusInternalServerError, message)
+			return
+		}
+
+		var lastID uint64
+		if v := r.Header.Get("Last-Event-ID"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				message := fmt.Sprintf("Invalid Last-Event-ID: %s", err)
+				replyError(w, r, http.StatusBadRequest, message)
+				return
+			}
+			lastID = id
+		}
+
+		ch, backlog, cancel := svc.Subscribe(lastID)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 1000\n\n")
+
+		for _, ev := range backlog {
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		timeout := time.NewTimer(eventStreamTimeout)
+		defer timeout.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-timeout.C:
+				return
+			case ev, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, ev); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
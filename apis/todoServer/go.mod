@@ -2,4 +2,17 @@ module github.com/boeboe/learngo/apis/todoServer
 
 go 1.19
 
-require github.com/boeboe/learngo/interacting/todo v0.0.0-20221212165734-a1450e3ca926 // indirect
+require (
+	github.com/boeboe/learngo/interacting/todo v0.0.0-20221212165734-a1450e3ca926
+	github.com/graphql-go/graphql v0.8.1
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
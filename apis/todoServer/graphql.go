@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// todoObject returns the GraphQL representation of a todo item
+func todoObject(item todoItem) map[string]interface{} {
+	obj := map[string]interface{}{
+		"id":        item.ID,
+		"task":      item.Task,
+		"done":      item.Done,
+		"createdAt": item.CreatedAt.Format(time.RFC3339),
+	}
+	if !item.CompletedAt.IsZero() {
+		obj["completedAt"] = item.CompletedAt.Format(time.RFC3339)
+	}
+	return obj
+}
+
+// resolveItem returns a resolver for a field whose result is the todo item
+// returned by fn
+func resolveItem(fn func(p graphql.ResolveParams) (todoItem, error)) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		item, err := fn(p)
+		if err != nil {
+			return nil, err
+		}
+		return todoObject(item), nil
+	}
+}
+
+func newGraphQLSchema(svc *todoService) (graphql.Schema, error) {
+	todoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Todo",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"task":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"done":        &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"createdAt":   &graphql.Field{Type: graphql.String},
+			"completedAt": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	idArgs := graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"todos": &graphql.Field{
+				Type: graphql.NewList(todoType),
+				Args: graphql.FieldConfigArgument{
+					"done":   &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"search": &graphql.ArgumentConfig{Type: graphql.String},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: resolveTodos(svc),
+			},
+			"todo": &graphql.Field{
+				Type: todoType,
+				Args: idArgs,
+				Resolve: resolveItem(func(p graphql.ResolveParams) (todoItem, error) {
+					id, _ := p.Args["id"].(int)
+					return svc.Get(id)
+				}),
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"add": &graphql.Field{
+				Type: todoType,
+				Args: graphql.FieldConfigArgument{
+					"task": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: resolveItem(func(p graphql.ResolveParams) (todoItem, error) {
+					task, _ := p.Args["task"].(string)
+					return svc.Add(task)
+				}),
+			},
+			"complete": &graphql.Field{
+				Type: todoType,
+				Args: idArgs,
+				Resolve: resolveItem(func(p graphql.ResolveParams) (todoItem, error) {
+					id, _ := p.Args["id"].(int)
+					return svc.Complete(id)
+				}),
+			},
+			"update": &graphql.Field{
+				Type: todoType,
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"task": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: resolveItem(func(p graphql.ResolveParams) (todoItem, error) {
+					id, _ := p.Args["id"].(int)
+					task, _ := p.Args["task"].(string)
+					return svc.Update(id, task)
+				}),
+			},
+			"delete": &graphql.Field{
+				Type: todoType,
+				Args: idArgs,
+				Resolve: resolveItem(func(p graphql.ResolveParams) (todoItem, error) {
+					id, _ := p.Args["id"].(int)
+					return svc.Delete(id)
+				}),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+func resolveTodos(svc *todoService) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		lq := &listQuery{}
+		if done, ok := p.Args["done"].(bool); ok {
+			lq.done = &done
+		}
+		if search, ok := p.Args["search"].(string); ok {
+			lq.search = strings.ToLower(search)
+		}
+		lq.limit, _ = p.Args["limit"].(int)
+		lq.offset, _ = p.Args["offset"].(int)
+		if lq.limit < 0 || lq.offset < 0 {
+			return nil, fmt.Errorf("%w: limit and offset cannot be negative", ErrInvalidData)
+		}
+
+		items, err := svc.Items(lq)
+		if err != nil {
+			return nil, err
+		}
+		todos := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			todos[i] = todoObject(item)
+		}
+		return todos, nil
+	}
+}
+
+// graphqlHandler executes GraphQL queries and mutations POSTed as JSON
+// against the todo service
+func graphqlHandler(svc *todoService) http.HandlerFunc {
+	schema, err := newGraphQLSchema(svc)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			message := "Method not supported"
+			replyError(w, r, http.StatusMethodNotAllowed, message)
+			return
+		}
+
+		req := struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			replyDecodeError(w, r, err)
+			return
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        r.Context(),
+		})
+
+		body, err := json.Marshal(result)
+		if err != nil {
+			replyError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/boeboe/learngo/apis/todoServer --go-grpc_out=. --go-grpc_opt=module=github.com/boeboe/learngo/apis/todoServer todo.proto
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/boeboe/learngo/apis/todoServer/todopb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements TodoService on top of the todo service layer
+type grpcServer struct {
+	todopb.UnimplementedTodoServiceServer
+	svc *todoService
+}
+
+func newGRPCServer(svc *todoService) *grpc.Server {
+	var opts []grpc.ServerOption
+	if svc.lim.maxBodySize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(svc.lim.maxBodySize)))
+	}
+
+	s := grpc.NewServer(opts...)
+	todopb.RegisterTodoServiceServer(s, &grpcServer{svc: svc})
+	return s
+}
+
+// unixTime returns the Unix timestamp of t, 0 for the zero time
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func pbTodoFrom(item todoItem) *todopb.Todo {
+	return &todopb.Todo{
+		Id:          int32(item.ID),
+		Task:        item.Task,
+		Done:        item.Done,
+		CreatedAt:   unixTime(item.CreatedAt),
+		CompletedAt: unixTime(item.CompletedAt),
+	}
+}
+
+func pbEventFrom(ev event) *todopb.Event {
+	return &todopb.Event{
+		Id:   ev.ID,
+		Type: ev.Type,
+		Item: int32(ev.Item),
+		Task: ev.Task,
+		Date: ev.Date,
+	}
+}
+
+// grpcError converts a service error to a gRPC status error
+func grpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, ErrInvalidData):
+		code = codes.InvalidArgument
+	case errors.Is(err, ErrTooLarge):
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, err.Error())
+}
+
+// reply converts the result of a service call to a gRPC response
+func reply(item todoItem, err error) (*todopb.Todo, error) {
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return pbTodoFrom(item), nil
+}
+
+func (s *grpcServer) List(req *todopb.ListRequest, stream todopb.TodoService_ListServer) error {
+	if req.Limit < 0 || req.Offset < 0 {
+		return status.Error(codes.InvalidArgument, "limit and offset cannot be negative")
+	}
+
+	lq := &listQuery{
+		limit:  int(req.Limit),
+		offset: int(req.Offset),
+		done:   req.Done,
+		search: strings.ToLower(req.Search),
+	}
+	items, err := s.svc.Items(lq)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	for _, item := range items {
+		if err := stream.Send(pbTodoFrom(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *grpcServer) Get(ctx context.Context, req *todopb.TodoID) (*todopb.Todo, error) {
+	return reply(s.svc.Get(int(req.Id)))
+}
+
+func (s *grpcServer) Add(ctx context.Context, req *todopb.AddRequest) (*todopb.Todo, error) {
+	return reply(s.svc.Add(req.Task))
+}
+
+func (s *grpcServer) Complete(ctx context.Context, req *todopb.TodoID) (*todopb.Todo, error) {
+	return reply(s.svc.Complete(int(req.Id)))
+}
+
+func (s *grpcServer) Update(ctx context.Context, req *todopb.UpdateRequest) (*todopb.Todo, error) {
+	return reply(s.svc.Update(int(req.Id), req.Task))
+}
+
+func (s *grpcServer) Delete(ctx context.Context, req *todopb.TodoID) (*todopb.Todo, error) {
+	return reply(s.svc.Delete(int(req.Id)))
+}
+
+// Watch streams the change events until the client goes away, starting with
+// the ones following the requested last event ID
+func (s *grpcServer) Watch(req *todopb.WatchRequest, stream todopb.TodoService_WatchServer) error {
+	ch, backlog, cancel := s.svc.Subscribe(req.LastEventId)
+	defer cancel()
+
+	for _, ev := range backlog {
+		if err := stream.Send(pbEventFrom(ev)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-ch:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "event stream fell behind, resume with the last event ID")
+			}
+			if err := stream.Send(pbEventFrom(ev)); err != nil {
+				return err
+			}
+		}
+	}
+}
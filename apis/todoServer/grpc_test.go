@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/apis/todoServer/todopb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func setupGRPC(t *testing.T) (todopb.TodoServiceClient, func()) {
+	t.Helper()
+
+	tempTodoFile, err := ioutil.TempFile("", "todotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := newGRPCServer(newTodoService(tempTodoFile.Name(), limits{}))
+	go s.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := todopb.NewTodoServiceClient(conn)
+
+	for i := 1; i < 3; i++ {
+		req := &todopb.AddRequest{Task: fmt.Sprintf("Task number %d", i)}
+		if _, err := client.Add(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return client, func() {
+		conn.Close()
+		s.Stop()
+		os.Remove(tempTodoFile.Name())
+	}
+}
+
+func TestGRPCUnary(t *testing.T) {
+	type call func(context.Context, todopb.TodoServiceClient) (*todopb.Todo, error)
+	testCases := []struct {
+		name    string
+		call    call
+		expCode codes.Code
+		expTodo *todopb.Todo
+	}{
+		{name: "Get", call: func(ctx context.Context, c todopb.TodoServiceClient) (*todopb.Todo, error) {
+			return c.Get(ctx, &todopb.TodoID{Id: 2})
+		}, expTodo: &todopb.Todo{Id: 2, Task: "Task number 2"}},
+		{name: "Add", call: func(ctx context.Context, c todopb.TodoServiceClient) (*todopb.Todo, error) {
+			return c.Add(ctx, &todopb.AddRequest{Task: "Task number 3"})
+		}, expTodo: &todopb.Todo{Id: 3, Task: "Task number 3"}},
+		{name: "Complete", call: func(ctx context.Context, c todopb.TodoServiceClient) (*todopb.Todo, error) {
+			return c.Complete(ctx, &todopb.TodoID{Id: 1})
+		}, expTodo: &todopb.Todo{Id: 1, Task: "Task number 1", Done: true}},
+		{name: "Update", call: func(ctx context.Context, c todopb.TodoServiceClient) (*todopb.Todo, error) {
+			return c.Update(ctx, &todopb.UpdateRequest{Id: 2, Task: "Task number 2 updated"})
+		}, expTodo: &todopb.Todo{Id: 2, Task: "Task number 2 updated"}},
+		{name: "Delete", call: func(ctx context.Context, c todopb.TodoServiceClient) (*todopb.Todo, error) {
+			return c.Delete(ctx, &todopb.TodoID{Id: 3})
+		}, expTodo: &todopb.Todo{Id: 3, Task: "Task number 3"}},
+		{name: "NotFound", call: func(ctx context.Context, c todopb.TodoServiceClient) (*todopb.Todo, error) {
+			return c.Get(ctx, &todopb.TodoID{Id: 3})
+		}, expCode: codes.NotFound},
+		{name: "EmptyTask", call: func(ctx context.Context, c todopb.TodoServiceClient) (*todopb.Todo, error) {
+			return c.Add(ctx, &todopb.AddRequest{})
+		}, expCode: codes.InvalidArgument},
+	}
+
+	client, cleanup := setupGRPC(t)
+	defer cleanup()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := tc.call(context.Background(), client)
+			if status.Code(err) != tc.expCode {
+				t.Fatalf("expected code %s, got %s instead: %v", tc.expCode, status.Code(err), err)
+			}
+			if err != nil {
+				return
+			}
+
+			if resp.Id != tc.expTodo.Id || resp.Task != tc.expTodo.Task || resp.Done != tc.expTodo.Done {
+				t.Errorf("expected %v, got %v instead", tc.expTodo, resp)
+			}
+			if resp.CreatedAt == 0 {
+				t.Error("expected creation date, got none")
+			}
+			if resp.Done && resp.CompletedAt == 0 {
+				t.Error("expected completion date, got none")
+			}
+		})
+	}
+}
+
+func TestGRPCList(t *testing.T) {
+	done, notDone := true, false
+	testCases := []struct {
+		name     string
+		req      *todopb.ListRequest
+		expTasks []string
+		expIDs   []int32
+	}{
+		{name: "All", req: &todopb.ListRequest{},
+			expTasks: []string{"Task number 1", "Task number 2"},
+			expIDs:   []int32{1, 2}},
+		{name: "Search", req: &todopb.ListRequest{Search: "number 2"},
+			expTasks: []string{"Task number 2"},
+			expIDs:   []int32{2}},
+		{name: "Page", req: &todopb.ListRequest{Limit: 1, Offset: 1},
+			expTasks: []string{"Task number 2"},
+			expIDs:   []int32{2}},
+		{name: "Done", req: &todopb.ListRequest{Done: &done},
+			expTasks: []string{"Task number 2"},
+			expIDs:   []int32{2}},
+		// an explicit false done field is kept apart from a missing one
+		{name: "NotDone", req: &todopb.ListRequest{Done: &notDone},
+			expTasks: []string{"Task number 1"},
+			expIDs:   []int32{1}},
+	}
+
+	client, cleanup := setupGRPC(t)
+	defer cleanup()
+	if _, err := client.Complete(context.Background(), &todopb.TodoID{Id: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stream, err := client.List(context.Background(), tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var todos []*todopb.Todo
+			for {
+				todo, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				todos = append(todos, todo)
+			}
+
+			if len(todos) != len(tc.expTasks) {
+				t.Fatalf("expected %d items, got %d instead", len(tc.expTasks), len(todos))
+			}
+			for i, todo := range todos {
+				if todo.Task != tc.expTasks[i] || todo.Id != tc.expIDs[i] {
+					t.Errorf("expected item %d %q, got %d %q instead", tc.expIDs[i], tc.expTasks[i], todo.Id, todo.Task)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCWatch(t *testing.T) {
+	client, cleanup := setupGRPC(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the two initial items were events 1 and 2: resume after the first one
+	stream, err := client.Watch(ctx, &todopb.WatchRequest{LastEventId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Id != 2 || ev.Type != eventAdd || ev.Task != "Task number 2" {
+		t.Errorf("expected replayed add event 2, got %v instead", ev)
+	}
+
+	if _, err := client.Complete(ctx, &todopb.TodoID{Id: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if ev, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != eventComplete || ev.Item != 2 {
+		t.Errorf("expected complete event of item 2, got %v instead", ev)
+	}
+}
@@ -4,16 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"strconv"
-	"sync"
-
-	"github.com/boeboe/learngo/interacting/todo"
-)
-
-var (
-	ErrNotFound    = errors.New("not found")
-	ErrInvalidData = errors.New("invalid data")
+	"strings"
 )
 
 func rootHandler(w http.ResponseWriter, r *http.Request) {
@@ -22,27 +15,24 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if wantsHTML(r) {
+		replyUIIndex(w, r)
+		return
+	}
+
 	content := "There is an API here"
 	replyTextContent(w, r, http.StatusOK, content)
 }
 
-func todoRouter(todoFile string, l sync.Locker) http.HandlerFunc {
+func todoRouter(svc *todoService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		list := &todo.List{}
-		l.Lock()
-		defer l.Unlock()
-		if err := list.Get(todoFile); err != nil {
-			replyError(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
-
 		// we stripped /todo prefix before: root calls
 		if r.URL.Path == "" {
 			switch r.Method {
 			case http.MethodGet:
-				getAllHandler(w, r, list)
+				getAllHandler(w, r, svc)
 			case http.MethodPost:
-				addHandler(w, r, list, todoFile)
+				addHandler(w, r, svc)
 			default:
 				message := "Method not supported"
 				replyError(w, r, http.StatusMethodNotAllowed, message)
@@ -50,24 +40,30 @@ func todoRouter(todoFile string, l sync.Locker) http.HandlerFunc {
 			return
 		}
 
-		// we know there is a request id following
-		id, err := validateID(r.URL.Path, list)
-		if err != nil {
-			if errors.Is(err, ErrNotFound) {
-				replyError(w, r, http.StatusNotFound, err.Error())
+		if r.URL.Path == "batch" {
+			if r.Method != http.MethodPost {
+				message := "Method not supported"
+				replyError(w, r, http.StatusMethodNotAllowed, message)
 				return
 			}
+			batchHandler(w, r, svc)
+			return
+		}
+
+		// we know there is a request id following
+		id, err := parseID(r.URL.Path)
+		if err != nil {
 			replyError(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		switch r.Method {
 		case http.MethodGet:
-			getOneHandler(w, r, list, id)
+			getOneHandler(w, r, svc, id)
 		case http.MethodDelete:
-			deleteHandler(w, r, list, id, todoFile)
+			deleteHandler(w, r, svc, id)
 		case http.MethodPatch:
-			patchHandler(w, r, list, id, todoFile)
+			patchHandler(w, r, svc, id)
 		default:
 			message := "Method not supported"
 			replyError(w, r, http.StatusMethodNotAllowed, message)
@@ -75,74 +71,129 @@ func todoRouter(todoFile string, l sync.Locker) http.HandlerFunc {
 	}
 }
 
-func validateID(path string, list *todo.List) (int, error) {
-	id, err := strconv.Atoi(path)
-	if err != nil {
-		return 0, fmt.Errorf("%w: Invalid ID: %s", ErrInvalidData, err)
+func getAllHandler(w http.ResponseWriter, r *http.Request, svc *todoService) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := negotiate(r.Header.Get("Accept"), listMediaTypes)
+	if mediaType == "" {
+		message := "Supported media types: " + strings.Join(listMediaTypes, ", ")
+		replyError(w, r, http.StatusNotAcceptable, message)
+		return
 	}
-	if id < 1 {
-		return 0, fmt.Errorf("%w: Invalid ID: Less then one", ErrInvalidData)
+
+	lq, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		replyError(w, r, http.StatusBadRequest, err.Error())
+		return
 	}
-	if id > len(*list) {
-		return 0, fmt.Errorf("%w: ID %d not found", ErrNotFound, id)
+
+	list, err := svc.List()
+	if err != nil {
+		replyError(w, r, http.StatusInternalServerError, err.Error())
+		return
 	}
-	return id, nil
-}
 
-func getAllHandler(w http.ResponseWriter, r *http.Request, list *todo.List) {
+	filtered := lq.filter(&list)
 	resp := &todoResponse{
-		Results: *list,
+		Results:      lq.page(filtered),
+		TotalResults: len(filtered),
+		Next:         lq.next(r.URL.Query(), len(filtered)),
 	}
-	replyJSONContent(w, r, http.StatusOK, resp)
+
+	etag, err := resp.etag(mediaType)
+	if err != nil {
+		replyError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if setCacheHeaders(w, r, etag, svc.todoFile) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if resp.Next != "" {
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", resp.Next))
+	}
+	replyListContent(w, r, http.StatusOK, resp, mediaType)
 }
 
-func getOneHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int) {
+func getOneHandler(w http.ResponseWriter, r *http.Request, svc *todoService, id int) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := negotiate(r.Header.Get("Accept"), listMediaTypes)
+	if mediaType == "" {
+		message := "Supported media types: " + strings.Join(listMediaTypes, ", ")
+		replyError(w, r, http.StatusNotAcceptable, message)
+		return
+	}
+
+	list, err := svc.List()
+	if err != nil {
+		replyError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := validateID(id, &list); err != nil {
+		replyServiceError(w, r, err)
+		return
+	}
+
 	resp := &todoResponse{
-		Results: (*list)[id-1 : id],
+		Results:      list[id-1 : id],
+		TotalResults: 1,
 	}
-	replyJSONContent(w, r, http.StatusOK, resp)
+	replyListContent(w, r, http.StatusOK, resp, mediaType)
 }
 
-func deleteHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int, todoFile string) {
-	list.Delete(id)
-	if err := list.Save(todoFile); err != nil {
-		replyError(w, r, http.StatusInternalServerError, err.Error())
+func deleteHandler(w http.ResponseWriter, r *http.Request, svc *todoService, id int) {
+	if _, err := svc.Delete(id); err != nil {
+		replyServiceError(w, r, err)
 		return
 	}
 	replyTextContent(w, r, http.StatusNoContent, "")
 }
 
-func patchHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int, todoFile string) {
+func patchHandler(w http.ResponseWriter, r *http.Request, svc *todoService, id int) {
 	q := r.URL.Query()
 
-	if _, ok := q["complete"]; !ok {
-		message := "Missing query parameter 'complete'"
-		replyError(w, r, http.StatusBadRequest, message)
+	if _, ok := q["complete"]; ok {
+		if _, err := svc.Complete(id); err != nil {
+			replyServiceError(w, r, err)
+			return
+		}
+		replyTextContent(w, r, http.StatusNoContent, "")
 		return
 	}
 
-	list.Complete(id)
-	if err := list.Save(todoFile); err != nil {
-		replyError(w, r, http.StatusInternalServerError, err.Error())
+	// without the complete parameter the body carries the updated task
+	item := struct {
+		Task string `json:"task"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		if errors.Is(err, io.EOF) {
+			message := "Missing query parameter 'complete' or JSON task"
+			replyError(w, r, http.StatusBadRequest, message)
+			return
+		}
+		replyDecodeError(w, r, err)
+		return
+	}
+
+	if _, err := svc.Update(id, item.Task); err != nil {
+		replyServiceError(w, r, err)
 		return
 	}
 	replyTextContent(w, r, http.StatusNoContent, "")
 }
 
-func addHandler(w http.ResponseWriter, r *http.Request, list *todo.List, todoFile string) {
+func addHandler(w http.ResponseWriter, r *http.Request, svc *todoService) {
 	item := struct {
 		Task string `json:"task"`
 	}{}
 
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		message := fmt.Sprintf("Invalid JSON: %s", err)
-		replyError(w, r, http.StatusBadRequest, message)
+		replyDecodeError(w, r, err)
 		return
 	}
 
-	list.Add(item.Task)
-	if err := list.Save(todoFile); err != nil {
-		replyError(w, r, http.StatusInternalServerError, err.Error())
+	if _, err := svc.Add(item.Task); err != nil {
+		replyServiceError(w, r, err)
 		return
 	}
 	replyTextContent(w, r, http.StatusCreated, "")
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTooLarge = errors.New("too large")
+
+// maxRateBuckets is the number of clients the rate limiter tracks at once
+const maxRateBuckets = 10000
+
+// limits configures the request throttling and size caps of the server, a
+// zero value disabling the corresponding limit
+type limits struct {
+	rate        float64  // requests per second allowed per client
+	burst       int      // requests a client can make at once
+	rateByToken bool     // key clients on their bearer token instead of IP
+	rateTokens  []string // the known tokens, the only ones clients are keyed on
+	maxBodySize int64    // bytes
+	maxTaskLen  int      // characters
+	maxListSize int      // items
+}
+
+func (lim limits) checkTask(task string) error {
+	if lim.maxTaskLen > 0 && len([]rune(task)) > lim.maxTaskLen {
+		return fmt.Errorf("%w: Task longer than %d characters", ErrTooLarge, lim.maxTaskLen)
+	}
+	return nil
+}
+
+func (lim limits) checkListSize(size int) error {
+	if lim.maxListSize > 0 && size > lim.maxListSize {
+		return fmt.Errorf("%w: List cannot hold more than %d items", ErrTooLarge, lim.maxListSize)
+	}
+	return nil
+}
+
+// replyDecodeError replies to a request whose JSON body could not be decoded
+func replyDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		message := fmt.Sprintf("Body larger than %d bytes", maxErr.Limit)
+		replyError(w, r, http.StatusRequestEntityTooLarge, message)
+		return
+	}
+	message := fmt.Sprintf("Invalid JSON: %s", err)
+	replyError(w, r, http.StatusBadRequest, message)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per client: each bucket holds up to burst
+// tokens and refills at rate tokens per second, a request taking one token.
+// At most maxBuckets clients are tracked at once.
+type rateLimiter struct {
+	rate       float64
+	burst      float64
+	byToken    bool
+	tokens     []string
+	maxBuckets int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(lim limits) *rateLimiter {
+	burst := lim.burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:       lim.rate,
+		burst:      float64(burst),
+		byToken:    lim.rateByToken,
+		tokens:     lim.rateTokens,
+		maxBuckets: maxRateBuckets,
+		buckets:    make(map[string]*bucket),
+		lastSweep:  time.Now(),
+	}
+}
+
+// allow takes a token from the client bucket, returning how long the client
+// has to wait when there is none left
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.sweep(now)
+
+	b, ok := rl.buckets[client]
+	if !ok {
+		if len(rl.buckets) >= rl.maxBuckets {
+			rl.evict(now)
+		}
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = b
+	}
+
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the clients whose bucket refilled completely, at most once a
+// minute
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Minute {
+		return
+	}
+	rl.lastSweep = now
+	for client, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, client)
+		}
+	}
+}
+
+// evict makes room for a new client, forgetting the clients whose bucket
+// refilled completely or else the one seen least recently
+func (rl *rateLimiter) evict(now time.Time) {
+	rl.lastSweep = time.Time{}
+	rl.sweep(now)
+	if len(rl.buckets) < rl.maxBuckets {
+		return
+	}
+
+	oldest := ""
+	for client, b := range rl.buckets {
+		if oldest == "" || b.last.Before(rl.buckets[oldest].last) {
+			oldest = client
+		}
+	}
+	delete(rl.buckets, oldest)
+}
+
+// verified reports whether token is one of the tokens known to the server
+func (rl *rateLimiter) verified(token string) bool {
+	for _, t := range rl.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// clientKey identifies the client of a request by its IP, or by its bearer
+// token when keying on tokens and the token is a known one
+func (rl *rateLimiter) clientKey(r *http.Request) string {
+	if rl.byToken {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && rl.verified(token) {
+			return "token:" + token
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := rl.allow(rl.clientKey(r)); !ok {
+			secs := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			replyError(w, r, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
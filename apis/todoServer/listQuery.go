@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/boeboe/learngo/interacting/todo"
+)
+
+// listQuery holds the pagination and filter parameters of a GET /todo request
+type listQuery struct {
+	limit  int
+	offset int
+	done   *bool
+	search string
+}
+
+func parseListQuery(q url.Values) (*listQuery, error) {
+	lq := &listQuery{}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("%w: Invalid limit: %q", ErrInvalidData, v)
+		}
+		lq.limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("%w: Invalid offset: %q", ErrInvalidData, v)
+		}
+		lq.offset = offset
+	}
+
+	if v := q.Get("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: Invalid done: %q", ErrInvalidData, v)
+		}
+		lq.done = &done
+	}
+
+	lq.search = strings.ToLower(q.Get("q"))
+	return lq, nil
+}
+
+// matches reports whether an item matches the done status and search text
+func (lq *listQuery) matches(task string, done bool) bool {
+	if lq.done != nil && done != *lq.done {
+		return false
+	}
+	return lq.search == "" || strings.Contains(strings.ToLower(task), lq.search)
+}
+
+// filter returns the items of list matching the query
+func (lq *listQuery) filter(list *todo.List) todo.List {
+	filtered := todo.List{}
+	for _, t := range *list {
+		if lq.matches(t.Task, t.Done) {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+// page returns the window of list selected by offset and limit, a limit of
+// zero meaning no limit
+func (lq *listQuery) page(list todo.List) todo.List {
+	if lq.offset >= len(list) {
+		return todo.List{}
+	}
+	end := len(list)
+	if lq.limit > 0 && lq.offset+lq.limit < end {
+		end = lq.offset + lq.limit
+	}
+	return list[lq.offset:end]
+}
+
+// next returns the link to the following page, or an empty string if the
+// current page is the last one
+func (lq *listQuery) next(q url.Values, total int) string {
+	if lq.limit == 0 || lq.offset+lq.limit >= total {
+		return ""
+	}
+
+	nq := url.Values{}
+	for k, v := range q {
+		nq[k] = v
+	}
+	nq.Set("offset", strconv.Itoa(lq.offset+lq.limit))
+	return "/todo?" + nq.Encode()
+}
@@ -3,20 +3,83 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 func main() {
 	host := flag.String("h", "localhost", "server host")
 	port := flag.Int("p", 8080, "server port")
+	grpcPort := flag.Int("g", 9090, "gRPC server port, 0 to disable")
 	todoFile := flag.String("f", "todoServer.json", "todo json file")
+	rate := flag.Float64("rate", 10, "requests per second allowed per client, 0 to disable")
+	burst := flag.Int("burst", 20, "requests a client can burst above the rate")
+	rateByToken := flag.Bool("rate-by-token", false, "rate limit clients on their bearer token instead of IP")
+	rateTokens := flag.String("rate-tokens", os.Getenv("TODO_RATE_TOKENS"), "comma separated bearer tokens clients are rate limited on with -rate-by-token, the admin token being one")
+	maxBody := flag.Int64("max-body", 1<<20, "maximum request body size in bytes, 0 to disable")
+	maxTask := flag.Int("max-task", 1024, "maximum task length in characters, 0 to disable")
+	maxItems := flag.Int("max-items", 1000, "maximum number of items in the list, 0 to disable")
+	adminToken := flag.String("admin-token", os.Getenv("TODO_ADMIN_TOKEN"), "bearer token of the webhook admin API, empty to disable it")
+	hooksFile := flag.String("webhooks-file", "", "file persisting the registered webhooks")
+	corsOrigins := flag.String("cors-origins", "", "comma separated origins allowed to call the API from a browser, * for any")
 	flag.Parse()
 
+	var tokens []string
+	for _, t := range strings.Split(*rateTokens, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	if *adminToken != "" {
+		tokens = append(tokens, *adminToken)
+	}
+
+	lim := limits{
+		rate:        *rate,
+		burst:       *burst,
+		rateByToken: *rateByToken,
+		rateTokens:  tokens,
+		maxBodySize: *maxBody,
+		maxTaskLen:  *maxTask,
+		maxListSize: *maxItems,
+	}
+
+	svc := newTodoService(*todoFile, lim)
+
+	var hooks *dispatcher
+	if *adminToken != "" {
+		var err error
+		if hooks, err = newDispatcher(svc, *adminToken, *hooksFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var cors *corsPolicy
+	if *corsOrigins != "" {
+		cors = newCORSPolicy(*corsOrigins)
+	}
+
+	if *grpcPort > 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", *host, *grpcPort))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		go func() {
+			if err := newGRPCServer(svc).Serve(lis); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	s := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", *host, *port),
-		Handler:      newMux(*todoFile),
+		Handler:      newMux(svc, hooks, cors),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	mimeJSON = "application/json"
+	mimeCSV  = "text/csv"
+	mimeText = "text/plain"
+	mimeYAML = "application/yaml"
+)
+
+// listMediaTypes are the representations of the todo list in order of
+// preference, with the legacy YAML media types as aliases
+var listMediaTypes = []string{mimeJSON, mimeCSV, mimeText, mimeYAML,
+	"application/x-yaml", "text/yaml"}
+
+// negotiate returns the offer best matching the Accept header, the first
+// offer when the header is missing, or an empty string if none is acceptable
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// the most specific media range matching the offer sets its quality
+		q, specificity := 0.0, -1
+		for _, mr := range strings.Split(accept, ",") {
+			params := strings.Split(mr, ";")
+			mt := strings.ToLower(strings.TrimSpace(params[0]))
+
+			s := -1
+			switch {
+			case mt == offer:
+				s = 2
+			case mt == "*/*":
+				s = 0
+			case strings.HasSuffix(mt, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mt, "*")):
+				s = 1
+			}
+			if s <= specificity {
+				continue
+			}
+
+			specificity, q = s, 1.0
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if strings.ToLower(k) == "q" {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						q = f
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// replyListContent replies with resp in the negotiated media type
+func replyListContent(w http.ResponseWriter, r *http.Request, status int, resp *todoResponse, mediaType string) {
+	var body []byte
+	var err error
+
+	switch mediaType {
+	case mimeJSON:
+		replyJSONContent(w, r, status, resp)
+		return
+	case mimeCSV:
+		body, err = resp.csv()
+	case mimeText:
+		body = []byte(resp.Results.String())
+	default:
+		body, err = resp.yaml()
+	}
+	if err != nil {
+		replyError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// csv encodes the results with a header line, the dates in RFC 3339 and an
+// empty completion date for pending items
+func (r *todoResponse) csv() ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+
+	cw.Write([]string{"task", "done", "created_at", "completed_at"})
+	for _, t := range r.Results {
+		completed := ""
+		if !t.CompletedAt.IsZero() {
+			completed = t.CompletedAt.Format(time.RFC3339)
+		}
+		cw.Write([]string{t.Task, strconv.FormatBool(t.Done),
+			t.CreatedAt.Format(time.RFC3339), completed})
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// yaml encodes the response with snake case keys, leaving out the completion
+// date of pending items
+func (r *todoResponse) yaml() ([]byte, error) {
+	type yamlItem struct {
+		Task        string    `yaml:"task"`
+		Done        bool      `yaml:"done"`
+		CreatedAt   time.Time `yaml:"created_at"`
+		CompletedAt time.Time `yaml:"completed_at,omitempty"`
+	}
+
+	resp := struct {
+		Results      []yamlItem `yaml:"results"`
+		Date         int64      `yaml:"date"`
+		TotalResults int        `yaml:"total_results"`
+		Next         string     `yaml:"next,omitempty"`
+	}{
+		Results:      make([]yamlItem, 0, len(r.Results)),
+		Date:         time.Now().Unix(),
+		TotalResults: r.TotalResults,
+		Next:         r.Next,
+	}
+	for _, t := range r.Results {
+		resp.Results = append(resp.Results, yamlItem{t.Task, t.Done, t.CreatedAt, t.CompletedAt})
+	}
+	return yaml.Marshal(resp)
+}
@@ -4,19 +4,47 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"sync"
 )
 
-func newMux(todoFile string) http.Handler {
+// newMux returns the HTTP API of svc, with the webhook admin API when hooks
+// is not nil and open to the cross-origin requests allowed by cors if not nil
+func newMux(svc *todoService, hooks *dispatcher, cors *corsPolicy) http.Handler {
 	m := http.NewServeMux()
-	mu := &sync.Mutex{}
 
 	m.HandleFunc("/", rootHandler)
-	t := todoRouter(todoFile, mu)
+	m.Handle("/ui/", uiHandler())
+	t := todoRouter(svc)
 
 	m.Handle("/todo", http.StripPrefix("/todo", t))
 	m.Handle("/todo/", http.StripPrefix("/todo/", t))
-	return m
+	m.Handle("/todo/events", eventsHandler(svc))
+	m.Handle("/graphql", graphqlHandler(svc))
+
+	if hooks != nil {
+		wh := webhooksHandler(hooks)
+		m.Handle("/webhooks", http.StripPrefix("/webhooks", wh))
+		m.Handle("/webhooks/", http.StripPrefix("/webhooks/", wh))
+	}
+
+	var h http.Handler = m
+	if svc.lim.maxBodySize > 0 {
+		h = maxBodySize(h, svc.lim.maxBodySize)
+	}
+	if svc.lim.rate > 0 {
+		h = newRateLimiter(svc.lim).middleware(h)
+	}
+	// outermost so that throttled requests still carry the CORS headers
+	if cors != nil {
+		h = cors.middleware(h)
+	}
+	return h
+}
+
+func maxBodySize(next http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
 }
 
 func replyTextContent(w http.ResponseWriter, req *http.Request, status int, content string) {
@@ -25,7 +53,7 @@ func replyTextContent(w http.ResponseWriter, req *http.Request, status int, cont
 	w.Write([]byte(content))
 }
 
-func replyJSONContent(w http.ResponseWriter, req *http.Request, status int, resp *todoResponse) {
+func replyJSONContent(w http.ResponseWriter, req *http.Request, status int, resp json.Marshaler) {
 	body, err := json.Marshal(resp)
 	if err != nil {
 		replyError(w, req, http.StatusInternalServerError, err.Error())
@@ -36,6 +64,11 @@ func replyJSONContent(w http.ResponseWriter, req *http.Request, status int, resp
 	w.Write(body)
 }
 
+// replyServiceError replies with the HTTP status matching a service error
+func replyServiceError(w http.ResponseWriter, req *http.Request, err error) {
+	replyError(w, req, errorStatus(err), err.Error())
+}
+
 func replyError(w http.ResponseWriter, req *http.Request, status int, message string) {
 	log.Printf("%s %s: Error: %d %s", req.URL, req.Method, status, message)
 	http.Error(w, http.StatusText(status), status)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/boeboe/learngo/interacting/todo"
 )
@@ -24,7 +26,7 @@ func setupAPI(t *testing.T) (string, func()) {
 		t.Fatal(err)
 	}
 
-	ts := httptest.NewServer(newMux(tempTodoFile.Name()))
+	ts := httptest.NewServer(newMux(newTodoService(tempTodoFile.Name(), limits{}), nil, nil))
 	for i := 1; i < 3; i++ {
 		var body bytes.Buffer
 		taskName := fmt.Sprintf("Task number %d", i)
@@ -79,6 +81,20 @@ func TestGet(t *testing.T) {
 			expCode:    http.StatusOK,
 			expItems:   1,
 			expContent: "Task number 1"},
+		{name: "GetPage", path: "/todo?limit=1&offset=1",
+			expCode:    http.StatusOK,
+			expItems:   2,
+			expContent: "Task number 2"},
+		{name: "GetSearch", path: "/todo?q=NUMBER+2",
+			expCode:    http.StatusOK,
+			expItems:   1,
+			expContent: "Task number 2"},
+		{name: "GetNotDone", path: "/todo?done=false",
+			expCode:    http.StatusOK,
+			expItems:   2,
+			expContent: "Task number 1"},
+		{name: "InvalidLimit", path: "/todo?limit=abc",
+			expCode: http.StatusBadRequest},
 	}
 
 	url, cleanup := setupAPI(t)
@@ -131,6 +147,176 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestUI(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		accept     string
+		expType    string
+		expContent string
+	}{
+		{name: "Index", path: "/", accept: "text/html,application/xhtml+xml",
+			expType: "text/html", expContent: "<title>Todo</title>"},
+		{name: "Script", path: "/ui/app.js",
+			expType: "javascript", expContent: "/todo/events"},
+		{name: "Style", path: "/ui/style.css",
+			expType: "text/css", expContent: "li.done"},
+	}
+
+	url, cleanup := setupAPI(t)
+	defer cleanup()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, url+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+
+			if r.StatusCode != http.StatusOK {
+				t.Fatalf("expected %q, got %q instead", http.StatusText(http.StatusOK), http.StatusText(r.StatusCode))
+			}
+			if !strings.Contains(r.Header.Get("Content-Type"), tc.expType) {
+				t.Errorf("expected content type %q, got %q instead", tc.expType, r.Header.Get("Content-Type"))
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), tc.expContent) {
+				t.Errorf("expected %q in body", tc.expContent)
+			}
+		})
+	}
+}
+
+func TestGetPagination(t *testing.T) {
+	url, cleanup := setupAPI(t)
+	defer cleanup()
+
+	r, err := http.Get(url + "/todo?limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp todoResponse
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+
+	if len(resp.Results) != 1 {
+		t.Errorf("expected 1 item, got %d instead", len(resp.Results))
+	}
+	expNext := "/todo?limit=1&offset=1"
+	if resp.Next != expNext {
+		t.Fatalf("expected next link %q, got %q instead", expNext, resp.Next)
+	}
+
+	r, err = http.Get(url + resp.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = todoResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+
+	expTask := "Task number 2"
+	if resp.Results[0].Task != expTask {
+		t.Errorf("expected %q, got %q instead", expTask, resp.Results[0].Task)
+	}
+	if resp.Next != "" {
+		t.Errorf("expected no next link on last page, got %q instead", resp.Next)
+	}
+}
+
+func TestGetCache(t *testing.T) {
+	url, cleanup := setupAPI(t)
+	defer cleanup()
+
+	r, err := http.Get(url + "/todo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+
+	etag := r.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected ETag header, got none")
+	}
+	lastModified := r.Header.Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("expected Last-Modified header, got none")
+	}
+
+	testCases := []struct {
+		name    string
+		header  string
+		value   string
+		expCode int
+	}{
+		{name: "IfNoneMatch", header: "If-None-Match", value: etag,
+			expCode: http.StatusNotModified},
+		{name: "IfNoneMatchStale", header: "If-None-Match", value: `"stale"`,
+			expCode: http.StatusOK},
+		{name: "IfModifiedSince", header: "If-Modified-Since", value: lastModified,
+			expCode: http.StatusNotModified},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, url+"/todo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(tc.header, tc.value)
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+			if r.StatusCode != tc.expCode {
+				t.Errorf("expected %q, got %q instead", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+		})
+	}
+
+	t.Run("ChangedAfterComplete", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPatch, url+"/todo/1?complete", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+
+		req, err = http.NewRequest(http.MethodGet, url+"/todo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-None-Match", etag)
+		r, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			t.Errorf("expected %q, got %q instead", http.StatusText(http.StatusOK), http.StatusText(r.StatusCode))
+		}
+	})
+}
+
 func TestAdd(t *testing.T) {
 	url, cleanup := setupAPI(t)
 	defer cleanup()
@@ -268,3 +454,663 @@ func TestComplete(t *testing.T) {
 		}
 	})
 }
+
+func TestBatch(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       string
+		expCode    int
+		expApplied bool
+		expResults []batchResult
+		expTasks   []string
+	}{
+		{name: "Apply",
+			body: `{"operations":[
+				{"op":"add","task":"Task number 3"},
+				{"op":"complete","id":2},
+				{"op":"delete","id":1},
+				{"op":"update","id":2,"task":"Task number 2 updated"}]}`,
+			expCode:    http.StatusOK,
+			expApplied: true,
+			expResults: []batchResult{
+				{Op: opAdd, ID: 2, Status: http.StatusCreated},
+				{Op: opComplete, ID: 1, Status: http.StatusNoContent},
+				{Op: opDelete, Status: http.StatusNoContent},
+				{Op: opUpdate, ID: 1, Status: http.StatusNoContent},
+			},
+			expTasks: []string{"Task number 2 updated", "Task number 3"}},
+		{name: "Rollback",
+			body: `{"operations":[
+				{"op":"add","task":"Task number 3"},
+				{"op":"delete","id":9},
+				{"op":"rename","id":1}]}`,
+			expCode: http.StatusBadRequest,
+			expResults: []batchResult{
+				{Op: opAdd, Status: http.StatusFailedDependency},
+				{Op: opDelete, Status: http.StatusNotFound},
+				{Op: "rename", Status: http.StatusBadRequest},
+			},
+			expTasks: []string{"Task number 1", "Task number 2"}},
+		{name: "DeleteTwice",
+			body: `{"operations":[
+				{"op":"delete","id":1},
+				{"op":"delete","id":1}]}`,
+			expCode: http.StatusBadRequest,
+			expResults: []batchResult{
+				{Op: opDelete, Status: http.StatusFailedDependency},
+				{Op: opDelete, Status: http.StatusBadRequest},
+			},
+			expTasks: []string{"Task number 1", "Task number 2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanup := setupAPI(t)
+			defer cleanup()
+
+			r, err := http.Post(url+"/todo/batch", "application/json", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("expected %q, got %q instead", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+
+			var resp struct {
+				Results []batchResult `json:"results"`
+				Applied bool          `json:"applied"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+
+			if resp.Applied != tc.expApplied {
+				t.Errorf("expected applied %t, got %t instead", tc.expApplied, resp.Applied)
+			}
+			if len(resp.Results) != len(tc.expResults) {
+				t.Fatalf("expected %d results, got %d instead", len(tc.expResults), len(resp.Results))
+			}
+			for i, exp := range tc.expResults {
+				res := resp.Results[i]
+				if res.Op != exp.Op || res.ID != exp.ID || res.Status != exp.Status {
+					t.Errorf("result %d: expected %+v, got %+v instead", i, exp, res)
+				}
+			}
+
+			r, err = http.Get(url + "/todo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var list todoResponse
+			if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+
+			if len(list.Results) != len(tc.expTasks) {
+				t.Fatalf("expected %d items, got %d instead", len(tc.expTasks), len(list.Results))
+			}
+			for i, exp := range tc.expTasks {
+				if list.Results[i].Task != exp {
+					t.Errorf("expected %q, got %q instead", exp, list.Results[i].Task)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expData  string
+		expError string
+	}{
+		{name: "Todos",
+			query:   `{ todos { id task done } }`,
+			expData: `{"todos":[{"done":false,"id":1,"task":"Task number 1"},{"done":false,"id":2,"task":"Task number 2"}]}`},
+		{name: "TodosSearch",
+			query:   `{ todos(search: "NUMBER 2") { id task } }`,
+			expData: `{"todos":[{"id":2,"task":"Task number 2"}]}`},
+		{name: "Todo",
+			query:   `{ todo(id: 2) { task } }`,
+			expData: `{"todo":{"task":"Task number 2"}}`},
+		{name: "NotFound",
+			query:    `{ todo(id: 5) { task } }`,
+			expData:  `{"todo":null}`,
+			expError: "not found"},
+		{name: "Add",
+			query:   `mutation { add(task: "Task number 3") { id task } }`,
+			expData: `{"add":{"id":3,"task":"Task number 3"}}`},
+		{name: "CompleteAndUpdate",
+			query:   `mutation { complete(id: 1) { done } update(id: 2, task: "Task number 2 updated") { task } }`,
+			expData: `{"complete":{"done":true},"update":{"task":"Task number 2 updated"}}`},
+		{name: "Delete",
+			query:   `mutation { delete(id: 1) { task } }`,
+			expData: `{"delete":{"task":"Task number 1"}}`},
+		{name: "TodosDone",
+			query:   `{ done: todos(done: true) { id } open: todos(done: false, limit: 1) { id task } }`,
+			expData: `{"done":[],"open":[{"id":1,"task":"Task number 2 updated"}]}`},
+	}
+
+	url, cleanup := setupAPI(t)
+	defer cleanup()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			req := struct {
+				Query string `json:"query"`
+			}{
+				Query: tc.query,
+			}
+			if err := json.NewEncoder(&body).Encode(req); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := http.Post(url+"/graphql", "application/json", &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+			if r.StatusCode != http.StatusOK {
+				t.Fatalf("expected %q, got %q instead", http.StatusText(http.StatusOK), http.StatusText(r.StatusCode))
+			}
+
+			var resp struct {
+				Data   json.RawMessage `json:"data"`
+				Errors []struct {
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if string(resp.Data) != tc.expData {
+				t.Errorf("expected data %s, got %s instead", tc.expData, resp.Data)
+			}
+			switch {
+			case tc.expError == "" && len(resp.Errors) > 0:
+				t.Errorf("expected no errors, got %v instead", resp.Errors)
+			case tc.expError != "" && (len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, tc.expError)):
+				t.Errorf("expected error %q, got %v instead", tc.expError, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	type request struct {
+		method  string
+		path    string
+		body    string
+		expCode int
+	}
+
+	testCases := []struct {
+		name     string
+		lim      limits
+		requests []request
+	}{
+		{name: "BodyTooLarge", lim: limits{maxBodySize: 32},
+			requests: []request{
+				{http.MethodPost, "/todo", `{"task":"Task number 1"}`, http.StatusCreated},
+				{http.MethodPost, "/todo", `{"task":"Task number 2 is too large"}`, http.StatusRequestEntityTooLarge},
+			}},
+		{name: "TaskTooLong", lim: limits{maxTaskLen: 13},
+			requests: []request{
+				{http.MethodPost, "/todo", `{"task":"Task number 1"}`, http.StatusCreated},
+				{http.MethodPost, "/todo", `{"task":"Task number 10"}`, http.StatusRequestEntityTooLarge},
+				{http.MethodPatch, "/todo/1", `{"task":"Task number 10"}`, http.StatusRequestEntityTooLarge},
+			}},
+		{name: "ListFull", lim: limits{maxListSize: 1},
+			requests: []request{
+				{http.MethodPost, "/todo", `{"task":"Task number 1"}`, http.StatusCreated},
+				{http.MethodPost, "/todo", `{"task":"Task number 2"}`, http.StatusRequestEntityTooLarge},
+				{http.MethodPost, "/todo/batch", `{"operations":[{"op":"delete","id":1},{"op":"add","task":"Task number 2"}]}`, http.StatusOK},
+			}},
+		{name: "RateLimited", lim: limits{rate: 0.01, burst: 2},
+			requests: []request{
+				{http.MethodGet, "/todo", "", http.StatusOK},
+				{http.MethodGet, "/todo", "", http.StatusOK},
+				{http.MethodGet, "/todo", "", http.StatusTooManyRequests},
+			}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempTodoFile, err := ioutil.TempFile("", "todotest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tempTodoFile.Name())
+
+			ts := httptest.NewServer(newMux(newTodoService(tempTodoFile.Name(), tc.lim), nil, nil))
+			defer ts.Close()
+
+			for _, rq := range tc.requests {
+				req, err := http.NewRequest(rq.method, ts.URL+rq.path, strings.NewReader(rq.body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				r, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Body.Close()
+
+				if r.StatusCode != rq.expCode {
+					t.Errorf("%s %s: expected %q, got %q instead", rq.method, rq.path,
+						http.StatusText(rq.expCode), http.StatusText(r.StatusCode))
+				}
+				if r.StatusCode == http.StatusTooManyRequests && r.Header.Get("Retry-After") == "" {
+					t.Error("expected Retry-After header, got none")
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	rl := newRateLimiter(limits{rate: 0.01, burst: 1, rateByToken: true, rateTokens: []string{"known"}})
+
+	request := func(remoteAddr, token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/todo", nil)
+		r.RemoteAddr = remoteAddr
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r
+	}
+
+	testCases := []struct {
+		name   string
+		req    *http.Request
+		expKey string
+	}{
+		{name: "NoToken", req: request("10.0.0.1:1234", ""), expKey: "ip:10.0.0.1"},
+		{name: "KnownToken", req: request("10.0.0.1:1234", "known"), expKey: "token:known"},
+		{name: "UnknownToken", req: request("10.0.0.1:1234", "made-up"), expKey: "ip:10.0.0.1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if key := rl.clientKey(tc.req); key != tc.expKey {
+				t.Errorf("expected key %q, got %q instead", tc.expKey, key)
+			}
+		})
+	}
+
+	t.Run("MadeUpTokensShareBucket", func(t *testing.T) {
+		if ok, _ := rl.allow(rl.clientKey(request("10.0.0.2:1234", "token-1"))); !ok {
+			t.Fatal("expected first request allowed")
+		}
+		if ok, _ := rl.allow(rl.clientKey(request("10.0.0.2:1234", "token-2"))); ok {
+			t.Error("expected request with a new made up token throttled")
+		}
+	})
+
+	t.Run("BucketsCapped", func(t *testing.T) {
+		rl := newRateLimiter(limits{rate: 0.01, burst: 1})
+		rl.maxBuckets = 2
+		for _, client := range []string{"ip:a", "ip:b", "ip:c"} {
+			rl.allow(client)
+		}
+		if len(rl.buckets) != 2 {
+			t.Errorf("expected 2 buckets, got %d instead", len(rl.buckets))
+		}
+		if _, ok := rl.buckets["ip:a"]; ok {
+			t.Error("expected least recent client evicted")
+		}
+	})
+}
+
+func readEvent(t *testing.T, r *bufio.Reader) (string, event) {
+	t.Helper()
+
+	var (
+		typ string
+		ev  event
+	)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && typ != "":
+			return typ, ev
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	url, cleanup := setupAPI(t)
+	defer cleanup()
+
+	req, err := http.NewRequest(http.MethodGet, url+"/todo/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the two initial items were events 1 and 2: resume after the first one
+	req.Header.Set("Last-Event-ID", "1")
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	if !strings.Contains(r.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("unexpected content type: %q", r.Header.Get("Content-Type"))
+	}
+	stream := bufio.NewReader(r.Body)
+
+	testCases := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		expType string
+		expItem int
+		expTask string
+	}{
+		{name: "Replay", expType: eventAdd, expItem: 2,
+			expTask: "Task number 2"},
+		{name: "Add", method: http.MethodPost, path: "/todo",
+			body: `{"task":"Task number 3"}`, expType: eventAdd,
+			expItem: 3, expTask: "Task number 3"},
+		{name: "Complete", method: http.MethodPatch, path: "/todo/1?complete",
+			expType: eventComplete, expItem: 1, expTask: "Task number 1"},
+		{name: "Update", method: http.MethodPatch, path: "/todo/2",
+			body: `{"task":"Task number 2 updated"}`, expType: eventUpdate,
+			expItem: 2, expTask: "Task number 2 updated"},
+		{name: "Delete", method: http.MethodDelete, path: "/todo/3",
+			expType: eventDelete, expItem: 3, expTask: "Task number 3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.method != "" {
+				req, err := http.NewRequest(tc.method, url+tc.path, strings.NewReader(tc.body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				r, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Body.Close()
+			}
+
+			typ, ev := readEvent(t, stream)
+			if typ != tc.expType {
+				t.Errorf("expected event %q, got %q instead", tc.expType, typ)
+			}
+			if ev.Item != tc.expItem {
+				t.Errorf("expected item %d, got %d instead", tc.expItem, ev.Item)
+			}
+			if ev.Task != tc.expTask {
+				t.Errorf("expected task %q, got %q instead", tc.expTask, ev.Task)
+			}
+		})
+	}
+}
+
+func TestEventsAfterRestart(t *testing.T) {
+	url, cleanup := setupAPI(t)
+	defer cleanup()
+
+	req, err := http.NewRequest(http.MethodGet, url+"/todo/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a client of the server before it restarted saw more events than the
+	// two of the initial items
+	req.Header.Set("Last-Event-ID", "42")
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	if typ, _ := readEvent(t, bufio.NewReader(r.Body)); typ != eventReload {
+		t.Errorf("expected event %q, got %q instead", eventReload, typ)
+	}
+}
+
+func TestEventsExternalEdit(t *testing.T) {
+	defer func(d time.Duration) { watchInterval = d }(watchInterval)
+	watchInterval = 10 * time.Millisecond
+
+	tempTodoFile, err := ioutil.TempFile("", "todotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempTodoFile.Name())
+
+	ts := httptest.NewServer(newMux(newTodoService(tempTodoFile.Name(), limits{}), nil, nil))
+	defer ts.Close()
+
+	r, err := http.Get(ts.URL + "/todo/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	stream := bufio.NewReader(r.Body)
+
+	// the retry line is flushed once the stream is subscribed
+	if _, err := stream.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * watchInterval)
+
+	l := todo.List{}
+	l.Add("External task")
+	if err := l.Save(tempTodoFile.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	typ, _ := readEvent(t, stream)
+	if typ != eventReload {
+		t.Errorf("expected event %q, got %q instead", eventReload, typ)
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		accept     string
+		expCode    int
+		expType    string
+		expContent string
+	}{
+		{name: "Default", path: "/todo",
+			expCode: http.StatusOK, expType: mimeJSON,
+			expContent: `"Task":"Task number 1"`},
+		{name: "Any", path: "/todo", accept: "*/*",
+			expCode: http.StatusOK, expType: mimeJSON,
+			expContent: `"total_results":2`},
+		{name: "CSV", path: "/todo", accept: "text/csv",
+			expCode: http.StatusOK, expType: mimeCSV,
+			expContent: "task,done,created_at,completed_at\nTask number 1,false,"},
+		{name: "Text", path: "/todo", accept: "text/plain",
+			expCode: http.StatusOK, expType: mimeText,
+			expContent: "   (1) Task number 1\n   (2) Task number 2\n"},
+		{name: "YAML", path: "/todo/2", accept: "application/yaml",
+			expCode: http.StatusOK, expType: mimeYAML,
+			expContent: "results:\n    - task: Task number 2\n      done: false\n"},
+		{name: "YAMLAlias", path: "/todo", accept: "text/yaml",
+			expCode: http.StatusOK, expType: "text/yaml",
+			expContent: "total_results: 2"},
+		{name: "Quality", path: "/todo", accept: "application/json;q=0.5, text/csv",
+			expCode: http.StatusOK, expType: mimeCSV,
+			expContent: "Task number 2,false,"},
+		{name: "Wildcard", path: "/todo", accept: "text/*;q=0.8, text/csv;q=0",
+			expCode: http.StatusOK, expType: mimeText,
+			expContent: "(2) Task number 2"},
+		{name: "NotAcceptable", path: "/todo", accept: "application/xml",
+			expCode: http.StatusNotAcceptable},
+	}
+
+	url, cleanup := setupAPI(t)
+	defer cleanup()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, url+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("expected %q, got %q instead", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if r.Header.Get("Vary") != "Accept" {
+				t.Errorf("expected Vary Accept, got %q instead", r.Header.Get("Vary"))
+			}
+			if tc.expType == "" {
+				return
+			}
+
+			if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, tc.expType) {
+				t.Errorf("expected content type %q, got %q instead", tc.expType, ct)
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), tc.expContent) {
+				t.Errorf("expected %q in %q", tc.expContent, string(body))
+			}
+		})
+	}
+
+	t.Run("ETagPerType", func(t *testing.T) {
+		etags := map[string]bool{}
+		for _, accept := range []string{mimeJSON, mimeCSV} {
+			req, err := http.NewRequest(http.MethodGet, url+"/todo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", accept)
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+			etags[r.Header.Get("ETag")] = true
+		}
+		if len(etags) != 2 {
+			t.Errorf("expected distinct ETags per media type, got %v", etags)
+		}
+	})
+}
+
+func TestCORS(t *testing.T) {
+	testCases := []struct {
+		name      string
+		method    string
+		headers   map[string]string
+		expCode   int
+		expOrigin string
+		expMethod string
+	}{
+		{name: "SameOrigin", method: http.MethodGet,
+			expCode: http.StatusOK},
+		{name: "Allowed", method: http.MethodGet,
+			headers: map[string]string{"Origin": "https://app.example.com"},
+			expCode: http.StatusOK, expOrigin: "https://app.example.com"},
+		{name: "NotAllowed", method: http.MethodGet,
+			headers: map[string]string{"Origin": "https://evil.example.com"},
+			expCode: http.StatusOK},
+		{name: "PreflightPatch", method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPatch,
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+			expCode: http.StatusNoContent, expOrigin: "https://app.example.com",
+			expMethod: "GET, POST, PATCH, DELETE"},
+		{name: "PreflightDelete", method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			expCode: http.StatusNoContent, expOrigin: "https://app.example.com",
+			expMethod: "GET, POST, PATCH, DELETE"},
+		{name: "PreflightNotAllowed", method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			expCode: http.StatusForbidden},
+		{name: "PreflightMethod", method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": http.MethodPut,
+			},
+			expCode: http.StatusMethodNotAllowed, expOrigin: "https://app.example.com"},
+		{name: "PreflightHeader", method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPatch,
+				"Access-Control-Request-Headers": "X-Custom",
+			},
+			expCode: http.StatusForbidden, expOrigin: "https://app.example.com"},
+	}
+
+	tempTodoFile, err := ioutil.TempFile("", "todotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempTodoFile.Name())
+
+	cors := newCORSPolicy("https://app.example.com/, https://other.example.com")
+	ts := httptest.NewServer(newMux(newTodoService(tempTodoFile.Name(), limits{}), nil, cors))
+	defer ts.Close()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+"/todo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("expected %q, got %q instead", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if got := r.Header.Get("Access-Control-Allow-Origin"); got != tc.expOrigin {
+				t.Errorf("expected allowed origin %q, got %q instead", tc.expOrigin, got)
+			}
+			if got := r.Header.Get("Access-Control-Allow-Methods"); got != tc.expMethod {
+				t.Errorf("expected allowed methods %q, got %q instead", tc.expMethod, got)
+			}
+		})
+	}
+}
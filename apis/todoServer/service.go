@@ -0,0 +1,393 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/boeboe/learngo/interacting/todo"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrInvalidData = errors.New("invalid data")
+)
+
+// todoItem is a todo list item along with its ID, the 1-based position of
+// the item in the list
+type todoItem struct {
+	ID          int
+	Task        string
+	Done        bool
+	CreatedAt   time.Time
+	CompletedAt time.Time
+}
+
+// batchOutcome is the result of one batch operation, ID being the position
+// of the item once the whole batch is applied
+type batchOutcome struct {
+	Op  string
+	ID  int
+	Err error
+}
+
+// todoService holds the business logic shared by the HTTP, GraphQL and gRPC
+// transports. Every call loads and saves the todo file under the same lock,
+// and publishes its changes to the event broker.
+type todoService struct {
+	todoFile string
+	l        sync.Locker
+	b        *broker
+	lim      limits
+}
+
+func newTodoService(todoFile string, lim limits) *todoService {
+	mu := &sync.Mutex{}
+	return &todoService{
+		todoFile: todoFile,
+		l:        mu,
+		b:        newBroker(todoFile, mu),
+		lim:      lim,
+	}
+}
+
+func itemAt(list *todo.List, id int) todoItem {
+	t := (*list)[id-1]
+	return todoItem{
+		ID:          id,
+		Task:        t.Task,
+		Done:        t.Done,
+		CreatedAt:   t.CreatedAt,
+		CompletedAt: t.CompletedAt,
+	}
+}
+
+// parseID converts the string representation of an ID, as found in paths
+func parseID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: Invalid ID: %s", ErrInvalidData, err)
+	}
+	return id, nil
+}
+
+func validateID(id int, list *todo.List) error {
+	if id < 1 {
+		return fmt.Errorf("%w: Invalid ID: Less then one", ErrInvalidData)
+	}
+	if id > len(*list) {
+		return fmt.Errorf("%w: ID %d not found", ErrNotFound, id)
+	}
+	return nil
+}
+
+func validateTask(task string, lim limits) error {
+	if task == "" {
+		return fmt.Errorf("%w: Task cannot be empty", ErrInvalidData)
+	}
+	return lim.checkTask(task)
+}
+
+// load reads the todo list, callers must hold the lock
+func (s *todoService) load() (*todo.List, error) {
+	list := &todo.List{}
+	if err := list.Get(s.todoFile); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// save writes the todo list, callers must hold the lock
+func (s *todoService) save(list *todo.List) error {
+	if err := list.Save(s.todoFile); err != nil {
+		return err
+	}
+	s.b.track()
+	return nil
+}
+
+// List returns the whole todo list
+func (s *todoService) List() (todo.List, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return *list, nil
+}
+
+// Items returns the items matching lq, keeping their IDs
+func (s *todoService) Items(lq *listQuery) ([]todoItem, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	items := []todoItem{}
+	for i, t := range *list {
+		if lq.matches(t.Task, t.Done) {
+			items = append(items, itemAt(list, i+1))
+		}
+	}
+
+	if lq.offset >= len(items) {
+		return []todoItem{}, nil
+	}
+	items = items[lq.offset:]
+	if lq.limit > 0 && lq.limit < len(items) {
+		items = items[:lq.limit]
+	}
+	return items, nil
+}
+
+func (s *todoService) Get(id int) (todoItem, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return todoItem{}, err
+	}
+	if err := validateID(id, list); err != nil {
+		return todoItem{}, err
+	}
+	return itemAt(list, id), nil
+}
+
+func (s *todoService) Add(task string) (todoItem, error) {
+	if err := validateTask(task, s.lim); err != nil {
+		return todoItem{}, err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return todoItem{}, err
+	}
+	if err := s.lim.checkListSize(len(*list) + 1); err != nil {
+		return todoItem{}, err
+	}
+
+	list.Add(task)
+	if err := s.save(list); err != nil {
+		return todoItem{}, err
+	}
+
+	id := len(*list)
+	s.b.publish(eventAdd, id, task)
+	return itemAt(list, id), nil
+}
+
+func (s *todoService) Complete(id int) (todoItem, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return todoItem{}, err
+	}
+	if err := validateID(id, list); err != nil {
+		return todoItem{}, err
+	}
+
+	list.Complete(id)
+	if err := s.save(list); err != nil {
+		return todoItem{}, err
+	}
+
+	item := itemAt(list, id)
+	s.b.publish(eventComplete, id, item.Task)
+	return item, nil
+}
+
+func (s *todoService) Update(id int, task string) (todoItem, error) {
+	if err := validateTask(task, s.lim); err != nil {
+		return todoItem{}, err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return todoItem{}, err
+	}
+	if err := validateID(id, list); err != nil {
+		return todoItem{}, err
+	}
+
+	(*list)[id-1].Task = task
+	if err := s.save(list); err != nil {
+		return todoItem{}, err
+	}
+
+	s.b.publish(eventUpdate, id, task)
+	return itemAt(list, id), nil
+}
+
+// Delete removes item id, returning it as it was before the deletion
+func (s *todoService) Delete(id int) (todoItem, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return todoItem{}, err
+	}
+	if err := validateID(id, list); err != nil {
+		return todoItem{}, err
+	}
+
+	item := itemAt(list, id)
+	list.Delete(id)
+	if err := s.save(list); err != nil {
+		return todoItem{}, err
+	}
+
+	s.b.publish(eventDelete, id, item.Task)
+	return item, nil
+}
+
+// Batch applies a list of operations in a single load/save cycle. IDs refer
+// to the positions in the list before the batch, so deletes do not shift the
+// items targeted by the following operations. Either all operations are
+// applied or none, the returned boolean telling which.
+func (s *todoService) Batch(ops []batchOperation) ([]batchOutcome, bool, error) {
+	if len(ops) == 0 {
+		return nil, false, fmt.Errorf("%w: No operations in batch", ErrInvalidData)
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	list, err := s.load()
+	if err != nil {
+		return nil, false, err
+	}
+
+	size := len(*list)
+	deleted := make(map[int]bool)
+	results := make([]batchOutcome, len(ops))
+	applied := true
+
+	for i, op := range ops {
+		res := &results[i]
+		res.Op = op.Op
+
+		if err := validateOperation(op, size, deleted, s.lim); err != nil {
+			res.Err = err
+			applied = false
+			continue
+		}
+
+		switch op.Op {
+		case opAdd:
+			list.Add(op.Task)
+			res.ID = len(*list)
+		case opComplete:
+			list.Complete(op.ID)
+			res.ID = op.ID
+		case opUpdate:
+			(*list)[op.ID-1].Task = op.Task
+			res.ID = op.ID
+		case opDelete:
+			deleted[op.ID] = true
+			res.ID = op.ID
+		}
+	}
+
+	if !applied {
+		for i := range results {
+			results[i].ID = 0
+		}
+		return results, false, nil
+	}
+
+	if err := s.lim.checkListSize(len(*list) - len(deleted)); err != nil {
+		return nil, false, err
+	}
+
+	// delete from the end so the remaining positions stay valid
+	ids := make([]int, 0, len(deleted))
+	for id := range deleted {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+
+	tasks := make(map[int]string, len(ids))
+	for _, id := range ids {
+		tasks[id] = (*list)[id-1].Task
+		list.Delete(id)
+	}
+
+	if err := s.save(list); err != nil {
+		return nil, false, err
+	}
+
+	for _, id := range ids {
+		s.b.publish(eventDelete, id, tasks[id])
+	}
+	for i := range results {
+		res := &results[i]
+		// items deleted later in the batch have no position left
+		if res.Op == opDelete || (res.Op != opAdd && deleted[res.ID]) {
+			res.ID = 0
+			continue
+		}
+		res.ID = shiftedID(res.ID, ids)
+		s.b.publish(res.Op, res.ID, (*list)[res.ID-1].Task)
+	}
+
+	return results, true, nil
+}
+
+func validateOperation(op batchOperation, size int, deleted map[int]bool, lim limits) error {
+	switch op.Op {
+	case opAdd:
+		return validateTask(op.Task, lim)
+	case opUpdate:
+		if err := validateTask(op.Task, lim); err != nil {
+			return err
+		}
+	case opComplete, opDelete:
+	default:
+		return fmt.Errorf("%w: Unknown operation %q", ErrInvalidData, op.Op)
+	}
+
+	if op.ID < 1 {
+		return fmt.Errorf("%w: Invalid ID: Less then one", ErrInvalidData)
+	}
+	if op.ID > size {
+		return fmt.Errorf("%w: ID %d not found", ErrNotFound, op.ID)
+	}
+	if deleted[op.ID] {
+		return fmt.Errorf("%w: ID %d already deleted in batch", ErrInvalidData, op.ID)
+	}
+	return nil
+}
+
+// shiftedID returns the position of id once the deleted ids are removed
+func shiftedID(id int, deleted []int) int {
+	shifted := id
+	for _, d := range deleted {
+		if d < id {
+			shifted--
+		}
+	}
+	return shifted
+}
+
+// Subscribe returns the change events following lastID, see broker.subscribe
+func (s *todoService) Subscribe(lastID uint64) (chan event, []event, func()) {
+	return s.b.subscribe(lastID)
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/boeboe/learngo/interacting/todo"
 )
 
 type todoResponse struct {
-	Results todo.List `json:"results"`
+	Results      todo.List `json:"results"`
+	TotalResults int       `json:"total_results"`
+	Next         string    `json:"next,omitempty"`
 }
 
 func (r *todoResponse) MarshalJSON() ([]byte, error) {
@@ -16,10 +20,27 @@ func (r *todoResponse) MarshalJSON() ([]byte, error) {
 		Results      todo.List `json:"results"`
 		Date         int64     `json:"date"`
 		TotalResults int       `json:"total_results"`
+		Next         string    `json:"next,omitempty"`
 	}{
 		Results:      r.Results,
 		Date:         time.Now().Unix(),
-		TotalResults: len(r.Results),
+		TotalResults: r.TotalResults,
+		Next:         r.Next,
 	}
 	return json.Marshal(resp)
 }
+
+// etag returns a strong entity tag of the response content in mediaType,
+// leaving out the date as it changes on every request
+func (r *todoResponse) etag(mediaType string) (string, error) {
+	content, err := json.Marshal(struct {
+		Results      todo.List
+		TotalResults int
+		Next         string
+		MediaType    string
+	}{r.Results, r.TotalResults, r.Next, mediaType})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(content))[:32]), nil
+}
@@ -0,0 +1,92 @@
+"use strict";
+
+const list = document.getElementById("list");
+const total = document.getElementById("total");
+const errorBox = document.getElementById("error");
+const form = document.getElementById("add");
+const input = document.getElementById("task");
+
+function showError(message) {
+  errorBox.textContent = message;
+  errorBox.hidden = !message;
+}
+
+async function request(method, path, body) {
+  const opts = { method: method, headers: {} };
+  if (body !== undefined) {
+    opts.headers["Content-Type"] = "application/json";
+    opts.body = JSON.stringify(body);
+  }
+  const resp = await fetch(path, opts);
+  if (!resp.ok) {
+    throw new Error(method + " " + path + ": " + resp.status + " " + resp.statusText);
+  }
+  return resp;
+}
+
+// item ids are their 1-based position in the list
+function render(items) {
+  list.replaceChildren();
+  items.forEach((item, i) => {
+    const id = i + 1;
+    const li = document.createElement("li");
+    li.className = item.Done ? "done" : "";
+
+    const task = document.createElement("span");
+    task.textContent = item.Task;
+    li.append(task);
+
+    if (!item.Done) {
+      const complete = document.createElement("button");
+      complete.textContent = "Complete";
+      complete.onclick = () => run(() => request("PATCH", "/todo/" + id + "?complete"));
+      li.append(complete);
+    }
+
+    const del = document.createElement("button");
+    del.textContent = "Delete";
+    del.onclick = () => run(() => request("DELETE", "/todo/" + id));
+    li.append(del);
+
+    list.append(li);
+  });
+  total.textContent = items.length + " task(s)";
+}
+
+async function load() {
+  const resp = await request("GET", "/todo");
+  const data = await resp.json();
+  render(data.results || []);
+}
+
+async function run(action) {
+  try {
+    await action();
+    showError("");
+    await load();
+  } catch (err) {
+    showError(err.message);
+  }
+}
+
+form.onsubmit = (e) => {
+  e.preventDefault();
+  const task = input.value.trim();
+  if (!task) {
+    return;
+  }
+  run(async () => {
+    await request("POST", "/todo", { task: task });
+    input.value = "";
+  });
+};
+
+// refresh when the list changes elsewhere
+if (window.EventSource) {
+  const events = new EventSource("/todo/events");
+  ["add", "complete", "update", "delete", "reload"].forEach((type) => {
+    events.addEventListener(type, () => run(() => Promise.resolve()));
+  });
+}
+
+run(() => Promise.resolve());
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// webhookRetries is the number of delivery attempts of an event
+	webhookRetries = 5
+	// webhookBackoff is the delay before the first retry, doubling after
+	// every failed attempt
+	webhookBackoff = time.Second
+	// webhookQueueSize is the number of events waiting for delivery per
+	// webhook before new ones are dropped
+	webhookQueueSize = 100
+	// deliveryLogSize is the number of delivery attempts kept in the log
+	deliveryLogSize = 100
+)
+
+type webhook struct {
+	ID     int      `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+
+	queue chan event
+	stop  chan struct{}
+}
+
+// wants reports whether the webhook subscribed to events of type typ, no
+// filter meaning all events
+func (h *webhook) wants(typ string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// delivery is an entry of the delivery log, one per attempt
+type delivery struct {
+	Webhook int    `json:"webhook"`
+	Event   uint64 `json:"event"`
+	Type    string `json:"type"`
+	Attempt int    `json:"attempt"`
+	Status  int    `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Date    int64  `json:"date"`
+}
+
+// dispatcher POSTs the todo change events to the registered webhooks. Each
+// webhook has its own worker delivering the events in order, signed with the
+// webhook secret and retried with an exponential backoff.
+//
+// The X-Todo-Signature header of a delivery is the HMAC-SHA256 of the
+// X-Todo-Timestamp header, the Unix time of the attempt, followed by a dot and
+// the body. Receivers should check the signature, then reject the deliveries
+// whose timestamp is more than 5 minutes away from their clock, so that a
+// captured delivery cannot be replayed later, and ignore the X-Todo-Delivery
+// IDs they already processed within that window.
+type dispatcher struct {
+	svc        *todoService
+	adminToken string
+	hooksFile  string
+	client     *http.Client
+	retries    int
+	backoff    time.Duration
+
+	mu     sync.Mutex
+	hooks  map[int]*webhook
+	nextID int
+	log    []delivery
+	stop   chan struct{}
+}
+
+// newDispatcher returns a dispatcher whose webhooks are managed by clients
+// presenting adminToken, and persisted in hooksFile if not empty
+func newDispatcher(svc *todoService, adminToken, hooksFile string) (*dispatcher, error) {
+	d := &dispatcher{
+		svc:        svc,
+		adminToken: adminToken,
+		hooksFile:  hooksFile,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		retries:    webhookRetries,
+		backoff:    webhookBackoff,
+		hooks:      make(map[int]*webhook),
+	}
+
+	if hooksFile == "" {
+		return d, nil
+	}
+
+	content, err := os.ReadFile(hooksFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return d, nil
+		}
+		return nil, err
+	}
+	var hooks []*webhook
+	if err := json.Unmarshal(content, &hooks); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, h := range hooks {
+		d.start(h)
+		if h.ID > d.nextID {
+			d.nextID = h.ID
+		}
+	}
+	return d, nil
+}
+
+// start registers h and launches its worker, callers must hold d.mu
+func (d *dispatcher) start(h *webhook) {
+	h.queue = make(chan event, webhookQueueSize)
+	h.stop = make(chan struct{})
+	d.hooks[h.ID] = h
+	go d.work(h)
+
+	if d.stop == nil {
+		d.stop = make(chan struct{})
+		go d.run(d.stop)
+	}
+}
+
+// save persists the webhooks, callers must hold d.mu
+func (d *dispatcher) save() error {
+	if d.hooksFile == "" {
+		return nil
+	}
+	js, err := json.Marshal(d.list(true))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.hooksFile, js, 0600)
+}
+
+// list returns the webhooks ordered by ID, callers must hold d.mu
+func (d *dispatcher) list(withSecrets bool) []webhook {
+	hooks := make([]webhook, 0, len(d.hooks))
+	for _, h := range d.hooks {
+		c := webhook{ID: h.ID, URL: h.URL, Events: h.Events}
+		if withSecrets {
+			c.Secret = h.Secret
+		}
+		hooks = append(hooks, c)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+	return hooks
+}
+
+func (d *dispatcher) add(h *webhook) (*webhook, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: Invalid URL: %q", ErrInvalidData, h.URL)
+	}
+	for _, e := range h.Events {
+		switch e {
+		case eventAdd, eventComplete, eventUpdate, eventDelete, eventReload:
+		default:
+			return nil, fmt.Errorf("%w: Unknown event %q", ErrInvalidData, e)
+		}
+	}
+	if h.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		h.Secret = hex.EncodeToString(secret)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+	h.ID = d.nextID
+	d.start(h)
+	if err := d.save(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (d *dispatcher) remove(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, ok := d.hooks[id]
+	if !ok {
+		return fmt.Errorf("%w: Webhook %d not found", ErrNotFound, id)
+	}
+	delete(d.hooks, id)
+	close(h.stop)
+
+	if len(d.hooks) == 0 && d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	return d.save()
+}
+
+func (d *dispatcher) deliveries(id int) []delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := []delivery{}
+	for _, dl := range d.log {
+		if dl.Webhook == id {
+			deliveries = append(deliveries, dl)
+		}
+	}
+	return deliveries
+}
+
+func (d *dispatcher) record(dl delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if dl.Error != "" {
+		log.Printf("webhook %d: event %d: attempt %d: %s", dl.Webhook, dl.Event, dl.Attempt, dl.Error)
+	}
+	d.log = append(d.log, dl)
+	if len(d.log) > deliveryLogSize {
+		d.log = d.log[len(d.log)-deliveryLogSize:]
+	}
+}
+
+// run queues the change events to the interested webhooks. When it falls
+// behind, it subscribes again from the last event it saw.
+func (d *dispatcher) run(stop chan struct{}) {
+	var lastID uint64
+	for {
+		ch, backlog, cancel := d.svc.Subscribe(lastID)
+		for _, ev := range backlog {
+			d.dispatch(ev)
+			lastID = ev.ID
+		}
+
+		for open := true; open; {
+			select {
+			case <-stop:
+				cancel()
+				return
+			case ev, ok := <-ch:
+				if !ok {
+					open = false
+					break
+				}
+				d.dispatch(ev)
+				lastID = ev.ID
+			}
+		}
+		cancel()
+	}
+}
+
+func (d *dispatcher) dispatch(ev event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, h := range d.hooks {
+		if !h.wants(ev.Type) {
+			continue
+		}
+		select {
+		case h.queue <- ev:
+		default:
+			go d.record(delivery{Webhook: h.ID, Event: ev.ID, Type: ev.Type,
+				Error: "queue full, event dropped", Date: time.Now().Unix()})
+		}
+	}
+}
+
+// work delivers the queued events of h one after the other
+func (d *dispatcher) work(h *webhook) {
+	for {
+		select {
+		case <-h.stop:
+			return
+		case ev := <-h.queue:
+			d.deliver(h, ev)
+		}
+	}
+}
+
+// deliver POSTs ev to h, retrying on network errors, 429 and 5xx responses
+func (d *dispatcher) deliver(h *webhook, ev event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		d.record(delivery{Webhook: h.ID, Event: ev.ID, Type: ev.Type,
+			Error: err.Error(), Date: time.Now().Unix()})
+		return
+	}
+
+	wait := d.backoff
+	for attempt := 1; attempt <= d.retries; attempt++ {
+		dl := delivery{Webhook: h.ID, Event: ev.ID, Type: ev.Type,
+			Attempt: attempt, Date: time.Now().Unix()}
+		timestamp := strconv.FormatInt(dl.Date, 10)
+
+		retry := true
+		req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Todo-Event", ev.Type)
+			req.Header.Set("X-Todo-Delivery", strconv.FormatUint(ev.ID, 10))
+			req.Header.Set("X-Todo-Timestamp", timestamp)
+			req.Header.Set("X-Todo-Signature", sign(h.Secret, timestamp, body))
+
+			var resp *http.Response
+			resp, err = d.client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				dl.Status = resp.StatusCode
+				if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+					d.record(dl)
+					return
+				}
+				retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+				err = fmt.Errorf("unexpected status %q", resp.Status)
+			}
+		}
+		dl.Error = err.Error()
+		d.record(dl)
+
+		if !retry || attempt == d.retries {
+			return
+		}
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// sign returns the signature of a delivery made at timestamp, which every
+// attempt signs again so that retries stay fresh
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// authorized reports whether the request carries the admin token, a
+// dispatcher without admin token refusing every request
+func (d *dispatcher) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return d.adminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(d.adminToken)) == 1
+}
+
+type webhooksResponse struct {
+	Results interface{}
+}
+
+func (r *webhooksResponse) MarshalJSON() ([]byte, error) {
+	resp := struct {
+		Results interface{} `json:"results"`
+		Date    int64       `json:"date"`
+	}{
+		Results: r.Results,
+		Date:    time.Now().Unix(),
+	}
+	return json.Marshal(resp)
+}
+
+// webhooksHandler serves the webhook admin API: /webhooks to list and
+// register webhooks, /webhooks/{id} to delete one and
+// /webhooks/{id}/deliveries for its delivery log
+func webhooksHandler(d *dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !d.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			replyError(w, r, http.StatusUnauthorized, "Missing or invalid admin token")
+			return
+		}
+
+		// we stripped /webhooks prefix before: root calls
+		if r.URL.Path == "" {
+			switch r.Method {
+			case http.MethodGet:
+				d.mu.Lock()
+				hooks := d.list(false)
+				d.mu.Unlock()
+				replyJSONContent(w, r, http.StatusOK, &webhooksResponse{Results: hooks})
+			case http.MethodPost:
+				h := &webhook{}
+				if err := json.NewDecoder(r.Body).Decode(h); err != nil {
+					replyDecodeError(w, r, err)
+					return
+				}
+				h, err := d.add(h)
+				if err != nil {
+					replyServiceError(w, r, err)
+					return
+				}
+				// the secret is only ever returned on registration
+				resp := &webhooksResponse{Results: webhook{ID: h.ID, URL: h.URL, Events: h.Events, Secret: h.Secret}}
+				replyJSONContent(w, r, http.StatusCreated, resp)
+			default:
+				message := "Method not supported"
+				replyError(w, r, http.StatusMethodNotAllowed, message)
+			}
+			return
+		}
+
+		logPath := strings.HasSuffix(r.URL.Path, "/deliveries")
+		id, err := parseID(strings.TrimSuffix(r.URL.Path, "/deliveries"))
+		if err != nil {
+			replyError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		switch {
+		case logPath && r.Method == http.MethodGet:
+			replyJSONContent(w, r, http.StatusOK, &webhooksResponse{Results: d.deliveries(id)})
+		case !logPath && r.Method == http.MethodDelete:
+			if err := d.remove(id); err != nil {
+				replyServiceError(w, r, err)
+				return
+			}
+			replyTextContent(w, r, http.StatusNoContent, "")
+		default:
+			message := "Method not supported"
+			replyError(w, r, http.StatusMethodNotAllowed, message)
+		}
+	}
+}
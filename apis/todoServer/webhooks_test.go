@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receivedHook struct {
+	typ       string
+	signature string
+	timestamp string
+	body      []byte
+}
+
+func adminRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestWebhooks(t *testing.T) {
+	const token = "admin-token"
+
+	tempTodoFile, err := ioutil.TempFile("", "todotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempTodoFile.Name())
+	hooksFile := tempTodoFile.Name() + ".hooks"
+	defer os.Remove(hooksFile)
+
+	// the receiver fails the first delivery to exercise the retries
+	received := make(chan receivedHook, 10)
+	var once sync.Once
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed := false
+		once.Do(func() { failed = true })
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedHook{
+			typ:       r.Header.Get("X-Todo-Event"),
+			signature: r.Header.Get("X-Todo-Signature"),
+			timestamp: r.Header.Get("X-Todo-Timestamp"),
+			body:      body,
+		}
+	}))
+	defer receiver.Close()
+
+	svc := newTodoService(tempTodoFile.Name(), limits{})
+	d, err := newDispatcher(svc, token, hooksFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.backoff = 10 * time.Millisecond
+	ts := httptest.NewServer(newMux(svc, d, nil))
+	defer ts.Close()
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		for _, tok := range []string{"", "wrong-token"} {
+			r := adminRequest(t, http.MethodGet, ts.URL+"/webhooks", tok, "")
+			r.Body.Close()
+			if r.StatusCode != http.StatusUnauthorized {
+				t.Errorf("expected %q, got %q instead", http.StatusText(http.StatusUnauthorized), r.Status)
+			}
+		}
+	})
+
+	t.Run("InvalidRegistration", func(t *testing.T) {
+		for _, body := range []string{
+			`{"url": "ftp://example.com"}`,
+			`{"url": "` + receiver.URL + `", "events": ["unknown"]}`,
+			`{"url":`,
+		} {
+			r := adminRequest(t, http.MethodPost, ts.URL+"/webhooks", token, body)
+			r.Body.Close()
+			if r.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: expected %q, got %q instead", body, http.StatusText(http.StatusBadRequest), r.Status)
+			}
+		}
+	})
+
+	var secret string
+	t.Run("Register", func(t *testing.T) {
+		r := adminRequest(t, http.MethodPost, ts.URL+"/webhooks", token,
+			`{"url": "`+receiver.URL+`", "events": ["add"]}`)
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusCreated {
+			t.Fatalf("expected %q, got %q instead", http.StatusText(http.StatusCreated), r.Status)
+		}
+
+		var resp struct {
+			Results webhook `json:"results"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Results.ID != 1 || resp.Results.Secret == "" {
+			t.Fatalf("expected webhook 1 with a secret, got %+v instead", resp.Results)
+		}
+		secret = resp.Results.Secret
+
+		if _, err := os.Stat(hooksFile); err != nil {
+			t.Errorf("expected webhooks file to be saved: %s", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		r := adminRequest(t, http.MethodGet, ts.URL+"/webhooks", token, "")
+		defer r.Body.Close()
+
+		var resp struct {
+			Results []webhook `json:"results"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Results) != 1 || resp.Results[0].URL != receiver.URL {
+			t.Fatalf("expected the registered webhook, got %+v instead", resp.Results)
+		}
+		if resp.Results[0].Secret != "" {
+			t.Error("expected the secret to be hidden from the list")
+		}
+	})
+
+	t.Run("Deliver", func(t *testing.T) {
+		if _, err := svc.Add("Task number 1"); err != nil {
+			t.Fatal(err)
+		}
+		// filtered out: the webhook only wants add events
+		if _, err := svc.Complete(1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.Add("Task number 2"); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expTask := range []string{"Task number 1", "Task number 2"} {
+			var hook receivedHook
+			select {
+			case hook = <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for the webhook delivery")
+			}
+
+			ts, err := strconv.ParseInt(hook.timestamp, 10, 64)
+			if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+				t.Errorf("expected a recent timestamp, got %q instead", hook.timestamp)
+			}
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(hook.timestamp + "."))
+			mac.Write(hook.body)
+			if expSig := "sha256=" + hex.EncodeToString(mac.Sum(nil)); hook.signature != expSig {
+				t.Errorf("expected signature %q, got %q instead", expSig, hook.signature)
+			}
+
+			var ev event
+			if err := json.Unmarshal(hook.body, &ev); err != nil {
+				t.Fatal(err)
+			}
+			if hook.typ != eventAdd || ev.Type != eventAdd || ev.Task != expTask {
+				t.Errorf("expected add event of %q, got %q %+v instead", expTask, hook.typ, ev)
+			}
+		}
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		// the last attempt is recorded right after the receiver replied
+		var resp struct {
+			Results []delivery `json:"results"`
+		}
+		for i := 0; i < 50; i++ {
+			r := adminRequest(t, http.MethodGet, ts.URL+"/webhooks/1/deliveries", token, "")
+			err := json.NewDecoder(r.Body).Decode(&resp)
+			r.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Results) == 3 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if len(resp.Results) != 3 {
+			t.Fatalf("expected 3 delivery attempts, got %+v instead", resp.Results)
+		}
+		first, retry := resp.Results[0], resp.Results[1]
+		if first.Attempt != 1 || first.Status != http.StatusInternalServerError || first.Error == "" {
+			t.Errorf("expected failed first attempt, got %+v instead", first)
+		}
+		if retry.Attempt != 2 || retry.Status != http.StatusOK || retry.Event != first.Event {
+			t.Errorf("expected successful retry of event %d, got %+v instead", first.Event, retry)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		expStatus := []int{http.StatusNoContent, http.StatusNotFound}
+		for _, exp := range expStatus {
+			r := adminRequest(t, http.MethodDelete, ts.URL+"/webhooks/1", token, "")
+			r.Body.Close()
+			if r.StatusCode != exp {
+				t.Errorf("expected %q, got %q instead", http.StatusText(exp), r.Status)
+			}
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		r := adminRequest(t, http.MethodPost, ts.URL+"/webhooks", token,
+			`{"url": "`+receiver.URL+`", "secret": "shared"}`)
+		r.Body.Close()
+
+		reloaded, err := newDispatcher(svc, token, hooksFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reloaded.remove(2)
+
+		reloaded.mu.Lock()
+		hooks := reloaded.list(true)
+		reloaded.mu.Unlock()
+		if len(hooks) != 1 || hooks[0].ID != 2 || hooks[0].Secret != "shared" {
+			t.Errorf("expected webhook 2 to be reloaded, got %+v instead", hooks)
+		}
+	})
+}
@@ -2,14 +2,21 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/boeboe/learngo/cobra/pScan/scan"
 )
@@ -43,6 +50,18 @@ func setup(t *testing.T, hosts []string, initList bool) (string, func()) {
 func TestHostActions(t *testing.T) {
 
 	hosts := []string{"host1", "host2", "host3"}
+	add := func(meta scan.Host) func(io.Writer, string, []string) error {
+		return func(out io.Writer, hostsFile string, args []string) error {
+			return addAction(out, hostsFile, args, meta)
+		}
+	}
+	list := func(sel scan.Selector) func(io.Writer, string, []string) error {
+		return func(out io.Writer, hostsFile string, args []string) error {
+			return listAction(out, hostsFile, sel)
+		}
+	}
+	webMeta := scan.Host{Groups: []string{"web"}, Labels: map[string]string{"env": "prod", "dc": "eu"},
+		Ports: []string{"80", "443"}, Comment: "front end"}
 	testCases := []struct {
 		name       string
 		args       []string
@@ -55,13 +74,40 @@ func TestHostActions(t *testing.T) {
 			args:       hosts,
 			expOut:     "Added host: host1\nAdded host: host2\nAdded host: host3\n",
 			initList:   false,
-			actionFunc: addAction,
+			actionFunc: add(scan.Host{}),
 		},
 		{
 			name:       "ListAction",
 			expOut:     "host1\nhost2\nhost3\n",
 			initList:   true,
-			actionFunc: listAction,
+			actionFunc: list(scan.Selector{}),
+		},
+		{
+			name: "AddMetaAction",
+			args: []string{"web1", "web2"},
+			expOut: "Added host: web1\nAdded host: web2\n" +
+				"web1 groups=web dc=eu env=prod ports=80,443 # front end\n" +
+				"web2 groups=web dc=eu env=prod ports=80,443 # front end\n",
+			initList: false,
+			actionFunc: func(out io.Writer, hostsFile string, args []string) error {
+				if err := addAction(out, hostsFile, args, webMeta); err != nil {
+					return err
+				}
+				return listAction(out, hostsFile, scan.Selector{Labels: map[string]string{"env": "prod"}, Groups: []string{"web"}})
+			},
+		},
+		{
+			name:       "ListGroupAction",
+			expOut:     "",
+			initList:   true,
+			actionFunc: list(scan.Selector{Groups: []string{"web"}}),
+		},
+		{
+			name:       "AddRangesAction",
+			args:       []string{"10.0.0.0/28", "2001:db8::1-2001:db8::3"},
+			expOut:     "Added host: 10.0.0.0/28\nAdded host: 2001:db8::1-2001:db8::3\n",
+			initList:   false,
+			actionFunc: add(scan.Host{}),
 		},
 		{
 			name:       "DeleteAction",
@@ -121,11 +167,11 @@ func TestIntegration(t *testing.T) {
 	}
 
 	// add hosts to the list
-	if err := addAction(&out, tf, hosts); err != nil {
+	if err := addAction(&out, tf, hosts, scan.Host{}); err != nil {
 		t.Fatalf("expected no error, got %q instead\n", err)
 	}
 	// list hosts in the list before delete
-	if err := listAction(&out, tf, nil); err != nil {
+	if err := listAction(&out, tf, scan.Selector{}); err != nil {
 		t.Fatalf("expected no error, got %q instead\n", err)
 	}
 	// delete hosts to the list
@@ -133,11 +179,11 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("expected no error, got %q instead\n", err)
 	}
 	// list hosts in the list after delete
-	if err := listAction(&out, tf, nil); err != nil {
+	if err := listAction(&out, tf, scan.Selector{}); err != nil {
 		t.Fatalf("expected no error, got %q instead\n", err)
 	}
 	// scan hosts
-	if err := scanAction(&out, tf, nil); err != nil {
+	if err := scanAction(context.Background(), &out, scanConfig{hostsFile: tf, format: "text"}); err != nil {
 		t.Fatalf("expected no error, got %q instead\n", err)
 	}
 
@@ -179,23 +225,476 @@ func TestScanAction(t *testing.T) {
 		}
 	}
 
+	// the latency varies from one run to the other
 	expectedOut := fmt.Sprintln("localhost:")
-	expectedOut += fmt.Sprintf("\t%d: open\n", ports[0])
-	expectedOut += fmt.Sprintf("\t%d: closed\n", ports[1])
+	expectedOut += fmt.Sprintf("\t%d: open (syn-ack, LATENCY)\n", ports[0])
+	expectedOut += fmt.Sprintf("\t%d: closed (reset, LATENCY)\n", ports[1])
 	expectedOut += fmt.Sprintln()
 	expectedOut += fmt.Sprintln("unknownhostoutthere: Host not found")
 	expectedOut += fmt.Sprintln()
+	expectedRe := regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(expectedOut), "LATENCY", `[0-9.]+[µm]?s`) + "$")
 
 	// define var to capture the output
 	var out bytes.Buffer
 
 	// execute scan and capture output
-	if err := scanAction(&out, tf, ports); err != nil {
+	if err := scanAction(context.Background(), &out, scanConfig{hostsFile: tf, ports: ports, format: "text"}); err != nil {
 		t.Fatalf("expected no error, got %q instead\n", err)
 	}
 
 	// test scan output
+	if !expectedRe.MatchString(out.String()) {
+		t.Errorf("expected output %q, got %q instead\n", expectedOut, out.String())
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	results := []scan.Results{
+		{Host: "host1", PortStates: []scan.PortState{
+			{Port: 22, Protocol: scan.TCP, Service: "ssh", State: scan.StateOpen,
+				Latency: 1500 * time.Microsecond, Reason: "syn-ack"},
+			{Port: 23, Protocol: scan.TCP, Service: "telnet", State: scan.StateFiltered, Reason: "timeout"},
+			{Port: 54321, Protocol: scan.TCP},
+			{Port: 8080, Protocol: scan.TCP, Service: "http", State: scan.StateOpen, Reason: "syn-ack",
+				Banner: "HTTP/1.0 200 OK", Version: "nginx/1.18.0"},
+			{Port: 9999, Protocol: scan.TCP, State: scan.StateOpen, Reason: "syn-ack", Banner: "hello"},
+		}},
+		{Host: "host2", PortStates: []scan.PortState{
+			{Port: 53, Protocol: scan.UDP, Service: "domain", State: scan.StateOpenFiltered, Reason: "no-response"},
+			{Port: 54321, Protocol: scan.UDP, Latency: 250 * time.Microsecond, Reason: "port-unreach"},
+		}},
+	}
+
+	expectedOut := "host1:\n\t22 (ssh): open (syn-ack, 1.5ms)\n\t23 (telnet): filtered (timeout)\n\t54321: closed\n"
+	expectedOut += "\t8080 (http): open (syn-ack) nginx/1.18.0\n\t9999: open (syn-ack) \"hello\"\n\n"
+	expectedOut += "host2:\n\t53/udp (domain): open|filtered (no-response)\n\t54321/udp: closed (port-unreach, 250µs)\n\n"
+
+	var out bytes.Buffer
+	if err := printResults(&out, results); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
 	if out.String() != expectedOut {
 		t.Errorf("expected output %q, got %q instead\n", expectedOut, out.String())
 	}
 }
+
+func TestListExpandedCount(t *testing.T) {
+	tf, cleanup := setup(t, []string{"host1", "10.0.0.0/28", "10.0.0.1-3"}, true)
+	defer cleanup()
+
+	var out bytes.Buffer
+	if err := listAction(&out, tf, scan.Selector{}); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+
+	expectedOut := "10.0.0.0/28 (16 hosts)\nhost1\n10.0.0.1-3 (3 hosts)\n"
+	if out.String() != expectedOut {
+		t.Errorf("expected output %q, got %q instead\n", expectedOut, out.String())
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	start := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	results := []scan.Results{
+		{Host: "10.0.0.1", Addresses: []string{"10.0.0.1"}, Address: "10.0.0.1",
+			Names: []string{"web1.example.com", "www.example.com"}, PortStates: []scan.PortState{
+				{Port: 22, Protocol: scan.TCP, Service: "ssh", State: scan.StateOpen,
+					Latency: 1500 * time.Microsecond, Reason: "syn-ack", Version: "OpenSSH_8.9"},
+				{Port: 23, Protocol: scan.TCP, Service: "telnet", State: scan.StateFiltered, Reason: "timeout"},
+			}},
+		{Host: "unknownhostoutthere", NotFound: true},
+	}
+
+	testCases := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{name: "CSV", format: "csv",
+			expected: "host,port,protocol,service,state,reason,latency_ms,version,banner,address,names\n" +
+				"10.0.0.1,22,tcp,ssh,open,syn-ack,1.500,OpenSSH_8.9,,10.0.0.1,web1.example.com www.example.com\n" +
+				"10.0.0.1,23,tcp,telnet,filtered,timeout,,,,10.0.0.1,web1.example.com www.example.com\n" +
+				"unknownhostoutthere,,,,not-found,,,,,,\n"},
+		{name: "Table", format: "table",
+			expected: "HOST                 ADDRESS   PORT  PROTOCOL  SERVICE  STATE      REASON   LATENCY  VERSION\n" +
+				"10.0.0.1             10.0.0.1  22    tcp       ssh      open       syn-ack  1.5ms    OpenSSH_8.9\n" +
+				"10.0.0.1             10.0.0.1  23    tcp       telnet   filtered   timeout           \n" +
+				"unknownhostoutthere                                     not found                    \n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeResults(&out, tc.format, results, start); err != nil {
+				t.Fatalf("expected no error, got %q instead\n", err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("expected output %q, got %q instead\n", tc.expected, out.String())
+			}
+		})
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := writeResults(&out, "json", results, start); err != nil {
+			t.Fatalf("expected no error, got %q instead\n", err)
+		}
+		if !strings.Contains(out.String(), `"state": "open"`) {
+			t.Errorf("expected state as text, got %q instead\n", out.String())
+		}
+
+		var decoded []scan.Results
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, results) {
+			t.Errorf("expected %v, got %v instead\n", results, decoded)
+		}
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := writeResults(&out, "xml", results, start); err != nil {
+			t.Fatalf("expected no error, got %q instead\n", err)
+		}
+
+		var run nmapRun
+		if err := xml.Unmarshal(out.Bytes(), &run); err != nil {
+			t.Fatal(err)
+		}
+		if run.Scanner != "pScan" || len(run.Hosts) != 2 || run.Start != start.Unix() {
+			t.Fatalf("expected 2 hosts scanned by pScan at %d, got %+v instead\n", start.Unix(), run)
+		}
+
+		up := run.Hosts[0]
+		if up.Status.State != "up" || up.Address == nil || up.Address.AddrType != "ipv4" {
+			t.Errorf("expected host up with an ipv4 address, got %+v instead\n", up)
+		}
+		expNames := []nmapHostname{{Name: "web1.example.com", Type: "PTR"}, {Name: "www.example.com", Type: "PTR"}}
+		if !reflect.DeepEqual(up.Hostnames, expNames) {
+			t.Errorf("expected hostnames %+v, got %+v instead\n", expNames, up.Hostnames)
+		}
+		expPort := nmapPort{Protocol: "tcp", PortID: 22,
+			State:   nmapState{State: "open", Reason: "syn-ack"},
+			Service: &nmapService{Name: "ssh", Product: "OpenSSH_8.9"}}
+		if len(up.Ports) != 2 || !reflect.DeepEqual(up.Ports[0], expPort) {
+			t.Errorf("expected first port %+v, got %+v instead\n", expPort, up.Ports)
+		}
+
+		down := run.Hosts[1]
+		if down.Status.State != "down" || len(down.Hostnames) != 1 || down.Hostnames[0].Name != "unknownhostoutthere" {
+			t.Errorf("expected host down with its name, got %+v instead\n", down)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := writeResults(&out, "yaml", results, start); !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("expected error %q, got %q instead\n", ErrInvalidFormat, err)
+		}
+	})
+}
+
+func TestHistoryActions(t *testing.T) {
+	tf, cleanup := setup(t, []string{"localhost"}, true)
+	defer cleanup()
+	hf, hfCleanup := setup(t, nil, false)
+	defer hfCleanup()
+
+	ln, err := net.Listen("tcp", net.JoinHostPort("localhost", "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// scan with the port open, then closed
+	var out bytes.Buffer
+	cfg := scanConfig{hostsFile: tf, historyFile: hf, ports: []int{port}, format: "text"}
+	if err := scanAction(context.Background(), &out, cfg); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+	ln.Close()
+	if err := scanAction(context.Background(), &out, cfg); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+
+	testCases := []struct {
+		name   string
+		action func(io.Writer) error
+		expOut string
+		expErr error
+	}{
+		{name: "Show", action: func(out io.Writer) error { return historyShowAction(out, hf, "1", "csv") },
+			expOut: fmt.Sprintf("localhost,%d,tcp,,open,syn-ack,", port)},
+		{name: "ShowNotExists", action: func(out io.Writer) error { return historyShowAction(out, hf, "3", "text") },
+			expErr: scan.ErrScanNotExists},
+		{name: "ShowInvalidID", action: func(out io.Writer) error { return historyShowAction(out, hf, "last", "text") },
+			expErr: scan.ErrScanNotExists},
+		{name: "DiffClosed", action: func(out io.Writer) error { return diffAction(out, hf, "1", "2") },
+			expOut: fmt.Sprintf("- localhost: %d/tcp closed\n", port)},
+		{name: "DiffOpened", action: func(out io.Writer) error { return diffAction(out, hf, "2", "1") },
+			expOut: fmt.Sprintf("+ localhost: %d/tcp opened\n", port)},
+		{name: "DiffNoChanges", action: func(out io.Writer) error { return diffAction(out, hf, "2", "2") },
+			expOut: "No changes\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := tc.action(&out)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Errorf("expected error %q, got %q instead\n", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %q instead\n", err)
+			}
+			if !strings.Contains(out.String(), tc.expOut) {
+				t.Errorf("expected output to contain %q, got %q instead\n", tc.expOut, out.String())
+			}
+		})
+	}
+
+	t.Run("List", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := historyListAction(&out, hf); err != nil {
+			t.Fatalf("expected no error, got %q instead\n", err)
+		}
+		expected := regexp.MustCompile(`^ID +DATE +PROTOCOL +PORTS +HOSTS +OPEN\n` +
+			`1 +\d{4}-\d\d-\d\d \d\d:\d\d:\d\d +tcp +1 +1 +1\n` +
+			`2 +\d{4}-\d\d-\d\d \d\d:\d\d:\d\d +tcp +1 +1 +0\n$`)
+		if !expected.MatchString(out.String()) {
+			t.Errorf("expected output to match %q, got %q instead\n", expected, out.String())
+		}
+	})
+
+	t.Run("Trimmed", func(t *testing.T) {
+		cfg.historySize = 2
+		if err := scanAction(context.Background(), io.Discard, cfg); err != nil {
+			t.Fatalf("expected no error, got %q instead\n", err)
+		}
+		h := &scan.History{}
+		if err := h.Load(hf); err != nil {
+			t.Fatal(err)
+		}
+		if len(h.Records) != 2 || h.Records[0].ID != 2 || h.Records[1].ID != 3 {
+			t.Errorf("expected scans 2 and 3 kept, got %+v instead\n", h.Records)
+		}
+	})
+}
+
+func TestMonitorAlertFlags(t *testing.T) {
+	// commands and URLs may contain commas, so the flags must not split them
+	for _, name := range []string{"exec", "webhook"} {
+		if typ := monitorCmd.Flags().Lookup(name).Value.Type(); typ != "stringArray" {
+			t.Errorf("expected --%s to be a stringArray, got %s instead\n", name, typ)
+		}
+	}
+}
+
+func TestMonitorAction(t *testing.T) {
+	tf, cleanup := setup(t, []string{"localhost"}, true)
+	defer cleanup()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// close the port after the baseline scan and stop after the alert
+	var alerts bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sink := &notifyFunc{func(a []scan.Alert) error {
+		for _, al := range a {
+			fmt.Fprintln(&alerts, al.Change)
+		}
+		cancel()
+		return nil
+	}}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ln.Close()
+	}()
+
+	var out, errOut bytes.Buffer
+	opts := scan.Options{Timeout: 100 * time.Millisecond}
+	if err := monitorAction(ctx, &out, &errOut, tf, scan.Selector{}, []int{port}, opts,
+		20*time.Millisecond, []scan.Sink{sink}); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("expected monitor to stop on alert, got %v instead\n", ctx.Err())
+	}
+	expAlert := fmt.Sprintf("- localhost: %d/tcp closed\n", port)
+	if !strings.Contains(alerts.String(), expAlert) {
+		t.Errorf("expected alert %q, got %q instead\n", expAlert, alerts.String())
+	}
+	expOut := "Monitoring every 20ms\nMonitoring stopped\n"
+	if out.String() != expOut {
+		t.Errorf("expected output %q, got %q instead\n", expOut, out.String())
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("expected no errors, got %q instead\n", errOut.String())
+	}
+}
+
+// notifyFunc is a sink calling a function
+type notifyFunc struct {
+	fn func([]scan.Alert) error
+}
+
+func (n *notifyFunc) Notify(alerts []scan.Alert) error {
+	return n.fn(alerts)
+}
+
+func TestPrintDiscovery(t *testing.T) {
+	start := time.Now()
+	results := []scan.Results{
+		{Host: "host1", Status: scan.StatusUp, Addresses: []string{"10.0.0.1", "2001:db8::1"},
+			PortStates: []scan.PortState{{Port: 22, Protocol: scan.TCP, State: scan.StateOpen}}},
+		{Host: "host2", Status: scan.StatusDown, Addresses: []string{"10.0.0.2"}},
+	}
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{format: "text", expected: "host1: Host up (10.0.0.1, 2001:db8::1)\n\t22: open\n\nhost2: Host down (10.0.0.2)\n\n"},
+		{format: "csv", expected: "host,port,protocol,service,state,reason,latency_ms,version,banner,address,names\n" +
+			"host1,22,tcp,,open,,,,,,\nhost2,,,,down,,,,,,\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeResults(&out, tc.format, results, start); err != nil {
+				t.Fatalf("expected no error, got %q instead\n", err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("expected output %q, got %q instead\n", tc.expected, out.String())
+			}
+		})
+	}
+
+	t.Run("xml", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := writeResults(&out, "xml", results, start); err != nil {
+			t.Fatalf("expected no error, got %q instead\n", err)
+		}
+		var run nmapRun
+		if err := xml.Unmarshal(out.Bytes(), &run); err != nil {
+			t.Fatal(err)
+		}
+		up, down := run.Hosts[0], run.Hosts[1]
+		if up.Status.State != "up" || up.Address == nil || up.Address.Addr != "10.0.0.1" || up.Hostnames[0].Name != "host1" {
+			t.Errorf("expected host1 up at 10.0.0.1, got %+v instead\n", up)
+		}
+		if down.Status.State != "down" || down.Status.Reason != "no-response" {
+			t.Errorf("expected host2 down, got %+v instead\n", down)
+		}
+	})
+}
+
+func TestPrintResolved(t *testing.T) {
+	addrs := []string{"10.0.0.1", "10.0.0.2"}
+	results := []scan.Results{
+		{Host: "host1", Addresses: addrs, Address: "10.0.0.1", Names: []string{"web1.example.com"},
+			PortStates: []scan.PortState{{Port: 22, Protocol: scan.TCP, State: scan.StateOpen}}},
+		{Host: "host1", Addresses: addrs, Address: "10.0.0.2", Status: scan.StatusDown,
+			Names: []string{"web2.example.com", "www.example.com"}},
+		{Host: "host2", Addresses: []string{"10.0.0.3"}, Address: "10.0.0.3",
+			PortStates: []scan.PortState{{Port: 22, Protocol: scan.TCP, State: scan.StateClosed}}},
+	}
+
+	expected := "host1 (10.0.0.1):\n\trDNS: web1.example.com\n\t22: open\n\n" +
+		"host1 (10.0.0.2): Host down (10.0.0.1, 10.0.0.2)\n\trDNS: web2.example.com, www.example.com\n\n" +
+		"host2:\n\t22: closed\n\n"
+
+	var out bytes.Buffer
+	if err := printResults(&out, results); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q instead\n", expected, out.String())
+	}
+}
+
+func TestScanActionInterrupted(t *testing.T) {
+	tf, cleanup := setup(t, []string{"localhost"}, true)
+	defer cleanup()
+	hf, hfCleanup := setup(t, nil, false)
+	defer hfCleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out, progress bytes.Buffer
+	cfg := scanConfig{hostsFile: tf, historyFile: hf, ports: []int{22}, format: "json", progress: &progress}
+	err := scanAction(ctx, &out, cfg)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %q, got %q instead\n", context.Canceled, err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("expected empty results, got %q instead\n", out.String())
+	}
+	if !strings.HasSuffix(progress.String(), "\r\033[K") {
+		t.Errorf("expected progress line to be cleared, got %q instead\n", progress.String())
+	}
+
+	h := &scan.History{}
+	if err := h.Load(hf); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Records) != 0 {
+		t.Errorf("expected interrupted scan not to be recorded, got %d records\n", len(h.Records))
+	}
+}
+
+func TestProgressPrinter(t *testing.T) {
+	var out bytes.Buffer
+	show := progressPrinter(&out, time.Hour)
+
+	show(scan.Progress{Hosts: 2, HostsDone: 0, Probes: 4, ProbesDone: 1})
+	// throttled
+	show(scan.Progress{Hosts: 2, HostsDone: 1, Probes: 4, ProbesDone: 2})
+	// always shown when done
+	show(scan.Progress{Hosts: 2, HostsDone: 2, Probes: 4, ProbesDone: 4})
+
+	expected := "\r\033[KScanning: 25% (1/4 probes, 0/2 hosts done)" +
+		"\r\033[KScanning: 100% (4/4 probes, 2/2 hosts done)"
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q instead\n", expected, out.String())
+	}
+}
+
+func TestDescribeTLS(t *testing.T) {
+	info := &scan.TLSInfo{
+		Version:     "TLS 1.3",
+		CipherSuite: "TLS_AES_128_GCM_SHA256",
+		Subject:     "CN=example.com",
+		SANs:        []string{"example.com", "www.example.com"},
+		Issuer:      "CN=example.com",
+		NotAfter:    time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+		SelfSigned:  true,
+		Expiring:    true,
+	}
+
+	results := []scan.Results{{Host: "host1", PortStates: []scan.PortState{
+		{Port: 443, Protocol: scan.TCP, Service: "https", State: scan.StateOpen, TLS: info}}}}
+	expected := "host1:\n\t443 (https): open\n" +
+		"\t\tTLS 1.3 TLS_AES_128_GCM_SHA256, subject \"CN=example.com\", issuer \"CN=example.com\", " +
+		"SANs example.com,www.example.com, expires 2022-11-01 (self-signed, expiring)\n\n"
+
+	var out bytes.Buffer
+	if err := printResults(&out, results); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q instead\n", expected, out.String())
+	}
+}
@@ -33,27 +33,63 @@ import (
 
 // addCmd represents the add command
 var addCmd = &cobra.Command{
-	Use:          "add <host1> <host2>",
-	Aliases:      []string{"a"},
-	Short:        "Add new host(s) to the hosts list",
+	Use:     "add <host1> <host2>",
+	Aliases: []string{"a"},
+	Short:   "Add new host(s) to the hosts list",
+	Long: `Adds new host(s) to the hosts list.
+
+Besides host names and IPv4 or IPv6 addresses, an entry can be:
+  a CIDR block such as 10.0.0.0/28 or 2001:db8::/120
+  an address range such as 10.0.0.1-20 or 2001:db8::1-2001:db8::ff
+  a file of targets, one per line, such as @targets.txt
+
+These entries are expanded to the hosts they stand for at scan time. Hostname
+globs such as web*.example.com are not supported.
+
+The groups, labels, ports and comment given by the flags apply to all the
+added hosts.`,
 	SilenceUsage: true,
 	Args:         cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		hostsFile := viper.GetString("hosts-file")
-		return addAction(os.Stdout, hostsFile, args)
+		groups, err := cmd.Flags().GetStringSlice("group")
+		if err != nil {
+			return err
+		}
+		labelSpecs, err := cmd.Flags().GetStringSlice("label")
+		if err != nil {
+			return err
+		}
+		labels, err := scan.ParseLabels(labelSpecs)
+		if err != nil {
+			return err
+		}
+		ports, err := cmd.Flags().GetStringSlice("ports")
+		if err != nil {
+			return err
+		}
+		comment, err := cmd.Flags().GetString("comment")
+		if err != nil {
+			return err
+		}
+		meta := scan.Host{Groups: groups, Labels: labels, Ports: ports, Comment: comment}
+		return addAction(os.Stdout, hostsFile, args, meta)
 	},
 }
 
-func addAction(out io.Writer, hostsFile string, args []string) error {
+// addAction adds the hosts in args, each with the metadata of meta
+func addAction(out io.Writer, hostsFile string, args []string, meta scan.Host) error {
 	hl := &scan.HostsList{}
 	if err := hl.Load(hostsFile); err != nil {
 		return err
 	}
-	for _, h := range args {
-		if err := hl.Add(h); err != nil {
+	for _, name := range args {
+		h := meta
+		h.Name = name
+		if err := hl.AddHost(h); err != nil {
 			return err
 		}
-		fmt.Fprintf(out, "Added host: %s\n", h)
+		fmt.Fprintf(out, "Added host: %s\n", name)
 	}
 	return hl.Save(hostsFile)
 }
@@ -70,4 +106,8 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// addCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addCmd.Flags().StringSlice("group", nil, "groups of the hosts")
+	addCmd.Flags().StringSlice("label", nil, "key=value labels of the hosts")
+	addCmd.Flags().StringSlice("ports", nil, "ports to scan on the hosts instead of the ports of the scan")
+	addCmd.Flags().String("comment", "", "comment on the hosts")
 }
@@ -0,0 +1,88 @@
+/*
+Copyright © 2022 Bart Van Bos
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <scan A> <scan B>",
+	Short: "Show the changes between two scans in the history",
+	Long: `Shows the changes between two scans in the history, given by their IDs
+
+Lines starting with + are hosts that appeared and ports that were opened since
+scan A, lines starting with - hosts that disappeared and ports that were closed.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		historyFile := viper.GetString("history-file")
+		return diffAction(os.Stdout, historyFile, args[0], args[1])
+	},
+}
+
+func diffAction(out io.Writer, historyFile, idA, idB string) error {
+	a, err := loadRecord(historyFile, idA)
+	if err != nil {
+		return err
+	}
+	b, err := loadRecord(historyFile, idB)
+	if err != nil {
+		return err
+	}
+	return printChanges(out, scan.Diff(a.Results, b.Results))
+}
+
+func printChanges(out io.Writer, changes []scan.Change) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(out, "No changes")
+		return err
+	}
+
+	message := ""
+	for _, c := range changes {
+		message += fmt.Sprintln(c)
+	}
+
+	_, err := fmt.Fprint(out, message)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// diffCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// diffCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2022 Bart Van Bos
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// historyListCmd represents the history list command
+var historyListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"l"},
+	Short:   "List the scans in the history",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		historyFile := viper.GetString("history-file")
+		return historyListAction(os.Stdout, historyFile)
+	},
+}
+
+func historyListAction(out io.Writer, historyFile string) error {
+	h := &scan.History{}
+	if err := h.Load(historyFile); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATE\tPROTOCOL\tPORTS\tHOSTS\tOPEN")
+	for _, r := range h.Records {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\n", r.ID, r.Time.Format("2006-01-02 15:04:05"),
+			r.Protocol, len(r.Ports), len(r.Results), r.OpenPorts())
+	}
+	return w.Flush()
+}
+
+func init() {
+	historyCmd.AddCommand(historyListCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// historyListCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// historyListCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
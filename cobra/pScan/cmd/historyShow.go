@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 Bart Van Bos
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// historyShowCmd represents the history show command
+var historyShowCmd = &cobra.Command{
+	Use:   "show <scan id>",
+	Short: "Show the results of a scan in the history",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		historyFile := viper.GetString("history-file")
+		format, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if !validFormat(format) {
+			return fmt.Errorf("%w: %q", ErrInvalidFormat, format)
+		}
+		return historyShowAction(os.Stdout, historyFile, args[0], format)
+	},
+}
+
+// loadRecord returns the scan of the history file with the given ID
+func loadRecord(historyFile, id string) (scan.Record, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return scan.Record{}, fmt.Errorf("%w: %q", scan.ErrScanNotExists, id)
+	}
+	h := &scan.History{}
+	if err := h.Load(historyFile); err != nil {
+		return scan.Record{}, err
+	}
+	return h.Get(n)
+}
+
+func historyShowAction(out io.Writer, historyFile, id, format string) error {
+	r, err := loadRecord(historyFile, id)
+	if err != nil {
+		return err
+	}
+	return writeResults(out, format, r.Results, r.Time)
+}
+
+func init() {
+	historyCmd.AddCommand(historyShowCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// historyShowCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	historyShowCmd.Flags().StringP("output", "o", "text", "format of the results: "+strings.Join(outputFormats, ", "))
+}
@@ -22,6 +22,7 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"github.com/boeboe/learngo/cobra/pScan/scan"
 	"github.com/spf13/cobra"
 )
 
@@ -33,7 +34,44 @@ var hostsCmd = &cobra.Command{
 
 Add hosts with the add command
 Delete hosts with the delete command
-List hosts with the list command.`,
+List hosts with the list command.
+
+The hosts file is a YAML document, or JSON if its name ends with .json, where
+hosts can belong to groups, carry labels and a comment, and have their own
+ports to scan:
+
+  hosts:
+    - name: web1.example.com
+      groups: [web]
+      labels: {env: prod}
+      ports: ["22", web]
+      comment: front end
+
+Hosts files with one host per line are read too, and migrated to YAML the next
+time the list changes.`,
+}
+
+// addSelectorFlags adds the flags selecting hosts by group and label to cmd
+func addSelectorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("group", nil, "only hosts in one of these groups")
+	cmd.Flags().StringSlice("label", nil, "only hosts with all these key=value labels")
+}
+
+// getSelector returns the selector given by the flags of addSelectorFlags
+func getSelector(cmd *cobra.Command) (scan.Selector, error) {
+	groups, err := cmd.Flags().GetStringSlice("group")
+	if err != nil {
+		return scan.Selector{}, err
+	}
+	labelSpecs, err := cmd.Flags().GetStringSlice("label")
+	if err != nil {
+		return scan.Selector{}, err
+	}
+	labels, err := scan.ParseLabels(labelSpecs)
+	if err != nil {
+		return scan.Selector{}, err
+	}
+	return scan.Selector{Groups: groups, Labels: labels}, nil
 }
 
 func init() {
@@ -25,6 +25,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/boeboe/learngo/cobra/pScan/scan"
 	"github.com/spf13/cobra"
@@ -38,23 +40,59 @@ var listCmd = &cobra.Command{
 	Short:   "List hosts in the hosts list",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		hostsFile := viper.GetString("hosts-file")
-		return listAction(os.Stdout, hostsFile, args)
+		sel, err := getSelector(cmd)
+		if err != nil {
+			return err
+		}
+		return listAction(os.Stdout, hostsFile, sel)
 	},
 }
 
-func listAction(out io.Writer, hostsFile string, args []string) error {
+func listAction(out io.Writer, hostsFile string, sel scan.Selector) error {
 	hl := &scan.HostsList{}
 	if err := hl.Load(hostsFile); err != nil {
 		return err
 	}
-	for _, h := range hl.Hosts {
-		if _, err := fmt.Fprintln(out, h); err != nil {
+	for _, h := range hl.Select(sel).Hosts {
+		if _, err := fmt.Fprintln(out, describeHost(h)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// describeHost returns the entry of a host, the number of hosts it expands
+// to and its metadata
+func describeHost(h scan.Host) string {
+	entry := h.Name
+	if scan.IsExpandable(h.Name) {
+		hosts, err := scan.ExpandTarget(h.Name)
+		if err != nil {
+			entry += fmt.Sprintf(" (%s)", err)
+		} else {
+			entry += fmt.Sprintf(" (%d hosts)", len(hosts))
+		}
+	}
+	if len(h.Groups) > 0 {
+		entry += " groups=" + strings.Join(h.Groups, ",")
+	}
+	keys := make([]string, 0, len(h.Labels))
+	for k := range h.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		entry += fmt.Sprintf(" %s=%s", k, h.Labels[k])
+	}
+	if len(h.Ports) > 0 {
+		entry += " ports=" + strings.Join(h.Ports, ",")
+	}
+	if h.Comment != "" {
+		entry += " # " + h.Comment
+	}
+	return entry
+}
+
 func init() {
 	hostsCmd.AddCommand(listCmd)
 
@@ -67,4 +105,5 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// listCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addSelectorFlags(listCmd)
 }
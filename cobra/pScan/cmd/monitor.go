@@ -0,0 +1,136 @@
+/*
+Copyright © 2022 Bart Van Bos
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// monitorCmd represents the monitor command
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Scan the hosts at regular intervals and alert on changes",
+	Long: `Scans the hosts at regular intervals and alerts when hosts appear or
+disappear and ports are opened, closed or change state, such as from closed to
+filtered, since the previous scan.
+
+Alerts are written to the standard output, and can also run a shell command
+with --exec or be posted as JSON to a URL with --webhook. The command gets the
+alert in the PSCAN_HOST, PSCAN_ADDRESS, PSCAN_CHANGE, PSCAN_PORT,
+PSCAN_PROTOCOL and PSCAN_SERVICE environment variables, and as JSON on its
+standard input. PSCAN_ADDRESS is only set for the hosts scanned on several
+addresses.
+
+The hosts file is read again before every scan, so that changes to the hosts
+list apply without restarting the monitor. It stops on SIGINT or SIGTERM.`,
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hostsFile := viper.GetString("hosts-file")
+		sel, ports, opts, err := getScanFlags(cmd)
+		if err != nil {
+			return err
+		}
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			return err
+		}
+		if interval <= 0 {
+			return fmt.Errorf("invalid interval %s", interval)
+		}
+		commands, err := cmd.Flags().GetStringArray("exec")
+		if err != nil {
+			return err
+		}
+		webhooks, err := cmd.Flags().GetStringArray("webhook")
+		if err != nil {
+			return err
+		}
+
+		sinks := []scan.Sink{&scan.WriterSink{W: os.Stdout}}
+		for _, c := range commands {
+			sinks = append(sinks, &scan.ExecSink{Command: c})
+		}
+		for _, u := range webhooks {
+			sinks = append(sinks, &scan.WebhookSink{URL: u})
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return monitorAction(ctx, os.Stdout, os.Stderr, hostsFile, sel, ports, opts, interval, sinks)
+	},
+}
+
+// monitorAction scans the hosts matching sel every interval until ctx is done,
+// reporting the errors to errOut
+func monitorAction(ctx context.Context, out, errOut io.Writer, hostsFile string, sel scan.Selector,
+	ports []int, opts scan.Options, interval time.Duration, sinks []scan.Sink) error {
+	m := &scan.Monitor{
+		Interval: interval,
+		Sinks:    sinks,
+		Scan: func(ctx context.Context) ([]scan.Results, error) {
+			hl := &scan.HostsList{}
+			if err := hl.Load(hostsFile); err != nil {
+				return nil, err
+			}
+			return scan.RunContext(ctx, hl.Select(sel), ports, opts)
+		},
+		OnError: func(err error) {
+			fmt.Fprintln(errOut, "Error:", err)
+		},
+	}
+
+	fmt.Fprintf(out, "Monitoring every %s\n", interval)
+	if err := m.Run(ctx); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "Monitoring stopped")
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+	addScanFlags(monitorCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// monitorCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// monitorCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	monitorCmd.Flags().DurationP("interval", "i", scan.DefaultInterval, "time between two scans")
+	monitorCmd.Flags().StringArray("exec", nil, "shell command to run for every alert, repeatable")
+	monitorCmd.Flags().StringArray("webhook", nil, "URL to post the alerts of every scan to, repeatable")
+}
@@ -0,0 +1,249 @@
+/*
+Copyright © 2022 Bart Van Bos
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+// outputFormats are the formats of the scan results, text being the default
+var outputFormats = []string{"text", "json", "csv", "xml", "table"}
+
+var ErrInvalidFormat = errors.New("Invalid output format")
+
+// validFormat reports whether format is one of the output formats
+func validFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResults writes the results of the scan started at start to out in
+// format
+func writeResults(out io.Writer, format string, results []scan.Results, start time.Time) error {
+	switch format {
+	case "text":
+		return printResults(out, results)
+	case "json":
+		return writeJSON(out, results)
+	case "csv":
+		return writeCSV(out, results)
+	case "xml":
+		return writeXML(out, results, start)
+	case "table":
+		return writeTable(out, results)
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidFormat, format)
+}
+
+func writeJSON(out io.Writer, results []scan.Results) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// latencyMillis formats a latency in milliseconds, empty when not measured
+func latencyMillis(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// writeCSV writes a line per host and port, hosts not found or down getting a
+// single line with the not-found or down state. The scanned address and its
+// PTR names, separated by spaces, come last so that the columns of the
+// earlier versions keep their place.
+func writeCSV(out io.Writer, results []scan.Results) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"host", "port", "protocol", "service", "state", "reason", "latency_ms", "version", "banner",
+		"address", "names"})
+
+	for _, res := range results {
+		names := strings.Join(res.Names, " ")
+		if res.NotFound {
+			w.Write([]string{res.Host, "", "", "", "not-found", "", "", "", "", "", ""})
+			continue
+		}
+		if res.Status == scan.StatusDown {
+			w.Write([]string{res.Host, "", "", "", "down", "", "", "", "", res.Address, names})
+			continue
+		}
+		for _, ps := range res.PortStates {
+			w.Write([]string{res.Host, strconv.Itoa(ps.Port), ps.Protocol, ps.Service,
+				ps.State.String(), ps.Reason, latencyMillis(ps.Latency), ps.Version, ps.Banner,
+				res.Address, names})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeTable(out io.Writer, results []scan.Results) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tADDRESS\tPORT\tPROTOCOL\tSERVICE\tSTATE\tREASON\tLATENCY\tVERSION")
+
+	for _, res := range results {
+		if res.NotFound {
+			fmt.Fprintf(w, "%s\t\t\t\t\tnot found\t\t\t\n", res.Host)
+			continue
+		}
+		if res.Status == scan.StatusDown {
+			fmt.Fprintf(w, "%s\t%s\t\t\t\tdown\t\t\t\n", res.Host, res.Address)
+			continue
+		}
+		for _, ps := range res.PortStates {
+			latency := ""
+			if ps.Latency > 0 {
+				latency = ps.Latency.Round(time.Microsecond).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", res.Host, res.Address, ps.Port, ps.Protocol,
+				ps.Service, ps.State, ps.Reason, latency, ps.Version)
+		}
+	}
+	return w.Flush()
+}
+
+// the nmap XML output elements pScan fills in
+type (
+	nmapRun struct {
+		XMLName xml.Name   `xml:"nmaprun"`
+		Scanner string     `xml:"scanner,attr"`
+		Start   int64      `xml:"start,attr"`
+		Version string     `xml:"version,attr"`
+		Hosts   []nmapHost `xml:"host"`
+	}
+	nmapHost struct {
+		Status    nmapStatus     `xml:"status"`
+		Address   *nmapAddress   `xml:"address,omitempty"`
+		Hostnames []nmapHostname `xml:"hostnames>hostname,omitempty"`
+		Ports     []nmapPort     `xml:"ports>port,omitempty"`
+	}
+	nmapStatus struct {
+		State  string `xml:"state,attr"`
+		Reason string `xml:"reason,attr"`
+	}
+	nmapAddress struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	}
+	nmapHostname struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	}
+	nmapPort struct {
+		Protocol string       `xml:"protocol,attr"`
+		PortID   int          `xml:"portid,attr"`
+		State    nmapState    `xml:"state"`
+		Service  *nmapService `xml:"service,omitempty"`
+	}
+	nmapState struct {
+		State  string `xml:"state,attr"`
+		Reason string `xml:"reason,attr"`
+	}
+	nmapService struct {
+		Name    string `xml:"name,attr"`
+		Product string `xml:"product,attr,omitempty"`
+		Banner  string `xml:"extrainfo,attr,omitempty"`
+	}
+)
+
+// writeXML writes the subset of the nmap XML format describing the hosts and
+// the state of their ports, so tools reading nmap results can read pScan's
+func writeXML(out io.Writer, results []scan.Results, start time.Time) error {
+	run := nmapRun{
+		Scanner: "pScan",
+		Start:   start.Unix(),
+		Version: rootCmd.Version,
+	}
+
+	for _, res := range results {
+		h := nmapHost{Status: nmapStatus{State: "up", Reason: "user-set"}}
+		switch {
+		case res.NotFound:
+			h.Status = nmapStatus{State: "down", Reason: "no-resolve"}
+		case res.Status == scan.StatusUp:
+			h.Status.Reason = "tcp-ping"
+		case res.Status == scan.StatusDown:
+			h.Status = nmapStatus{State: "down", Reason: "no-response"}
+		}
+
+		addr, err := netip.ParseAddr(res.Host)
+		if err != nil {
+			h.Hostnames = []nmapHostname{{Name: res.Host, Type: "user"}}
+			switch {
+			case res.Address != "":
+				addr, err = netip.ParseAddr(res.Address)
+			case len(res.Addresses) > 0:
+				addr, err = netip.ParseAddr(res.Addresses[0])
+			}
+		}
+		for _, name := range res.Names {
+			h.Hostnames = append(h.Hostnames, nmapHostname{Name: name, Type: "PTR"})
+		}
+		if err == nil {
+			h.Address = &nmapAddress{Addr: addr.String(), AddrType: "ipv4"}
+			if addr.Is6() {
+				h.Address.AddrType = "ipv6"
+			}
+		}
+
+		for _, ps := range res.PortStates {
+			p := nmapPort{
+				Protocol: ps.Protocol,
+				PortID:   ps.Port,
+				State:    nmapState{State: ps.State.String(), Reason: ps.Reason},
+			}
+			if ps.Service != "" {
+				p.Service = &nmapService{Name: ps.Service, Product: ps.Version, Banner: ps.Banner}
+			}
+			h.Ports = append(h.Ports, p)
+		}
+		run.Hosts = append(run.Hosts, h)
+	}
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(run); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out)
+	return err
+}
@@ -26,6 +26,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/boeboe/learngo/cobra/pScan/scan"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -41,7 +42,11 @@ var rootCmd = &cobra.Command{
 
 pScan allows you to add, list, and delete hosts from the list.
 
-pScan executes a port scan on specified TCP ports. You can customize the target 
+pScan keeps the results of every scan in a history, and shows the ports opened
+or closed between two scans. It can also monitor the hosts, scanning them at
+regular intervals and alerting on changes.
+
+pScan executes a port scan on specified TCP or UDP ports. You can customize the target 
 ports using a command line flag.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
@@ -66,11 +71,16 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pScan.yaml)")
 	rootCmd.PersistentFlags().StringP("hosts-file", "f", "pScan.hosts", "pScan hosts file")
+	rootCmd.PersistentFlags().String("history-file", "pScan.history", "pScan scan history file")
+	rootCmd.PersistentFlags().Int("history-size", scan.DefaultHistorySize,
+		"number of scans kept in the history, the oldest ones being dropped, 0 to keep them all")
 
 	replacer := strings.NewReplacer("-", "_")
 	viper.SetEnvKeyReplacer(replacer)
 	viper.SetEnvPrefix("PSCAN")
 	viper.BindPFlag("hosts-file", rootCmd.PersistentFlags().Lookup("hosts-file"))
+	viper.BindPFlag("history-file", rootCmd.PersistentFlags().Lookup("history-file"))
+	viper.BindPFlag("history-size", rootCmd.PersistentFlags().Lookup("history-size"))
 
 	versionTemplate := `{{printf "%s: %s - version %s\n" .Name .Short .Version}}`
 	rootCmd.SetVersionTemplate(versionTemplate)
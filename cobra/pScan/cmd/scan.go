@@ -22,9 +22,15 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/boeboe/learngo/cobra/pScan/scan"
 	"github.com/spf13/cobra"
@@ -37,34 +43,320 @@ var scanCmd = &cobra.Command{
 	Short: "Run a port scan on the hosts",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		hostsFile := viper.GetString("hosts-file")
-		ports, err := cmd.Flags().GetIntSlice("ports")
+		historyFile := viper.GetString("history-file")
+		historySize := viper.GetInt("history-size")
+		sel, ports, opts, err := getScanFlags(cmd)
 		if err != nil {
 			return err
 		}
-		return scanAction(os.Stdout, hostsFile, ports)
+		format, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if !validFormat(format) {
+			return fmt.Errorf("%w: %q", ErrInvalidFormat, format)
+		}
+		outFile, err := cmd.Flags().GetString("out-file")
+		if err != nil {
+			return err
+		}
+		progress, err := cmd.Flags().GetBool("progress")
+		if err != nil {
+			return err
+		}
+
+		cfg := scanConfig{
+			hostsFile:   hostsFile,
+			historyFile: historyFile,
+			historySize: historySize,
+			sel:         sel,
+			ports:       ports,
+			opts:        opts,
+			format:      format,
+		}
+		if progress && isTerminal(os.Stderr) {
+			cfg.progress = os.Stderr
+		}
+
+		// the flags are valid, the errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if outFile == "" {
+			return scanAction(ctx, os.Stdout, cfg)
+		}
+		f, err := os.Create(outFile)
+		if err != nil {
+			return err
+		}
+		if err := scanAction(ctx, f, cfg); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
 	},
 }
 
-func scanAction(out io.Writer, hostsFile string, ports []int) error {
+// scanConfig is what scanAction scans and where it reports it
+type scanConfig struct {
+	hostsFile   string
+	historyFile string
+	// historySize is the number of scans kept in the history
+	historySize int
+	sel         scan.Selector
+	ports       []int
+	opts        scan.Options
+	format      string
+	// progress receives the progress of the scan when not nil
+	progress io.Writer
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// addScanFlags adds the flags selecting the hosts and ports to scan and
+// tuning the scan to cmd
+func addScanFlags(cmd *cobra.Command) {
+	groups := strings.Join(scan.PortGroups(), ", ")
+	cmd.Flags().StringSliceP("ports", "p", []string{"22", "80", "443"},
+		"ports to scan: numbers, ranges such as 1-1024 or groups ("+groups+")")
+	cmd.Flags().StringSlice("exclude-ports", nil, "ports to leave out, in the same format as --ports")
+	cmd.Flags().Int("top-ports", 0,
+		fmt.Sprintf("also scan the given number of most common ports, up to %d", scan.MaxTopPorts))
+	cmd.Flags().String("protocol", scan.TCP, "protocol of the scanned ports: tcp or udp")
+	cmd.Flags().DurationP("timeout", "t", scan.DefaultTimeout, "time to wait for a port to answer")
+	cmd.Flags().BoolP("banners", "b", false, "grab the banners of open TCP ports to identify their service and version")
+	cmd.Flags().IntP("concurrency", "c", scan.DefaultConcurrency, "maximum number of parallel probes")
+	cmd.Flags().Float64("rate", 0, "maximum probes per second to a single host, 0 for no limit")
+	cmd.Flags().Bool("tls", false, "inspect the TLS certificates of the open TLS ports")
+	cmd.Flags().IntSlice("tls-ports", scan.DefaultTLSPorts, "TCP ports inspected for TLS")
+	cmd.Flags().Int("expiry-days", scan.DefaultExpiryDays, "flag the certificates expiring within this number of days")
+	cmd.Flags().Bool("discover", false, "ping the hosts first, leaving out the hosts that are down")
+	cmd.Flags().IntSlice("discovery-ports", scan.DefaultDiscoveryPorts, "TCP ports of the discovery ping")
+	cmd.Flags().Bool("all-addresses", false, "scan every address of the hosts instead of the first one")
+	cmd.Flags().Bool("reverse-dns", false, "look up the PTR names of the scanned addresses")
+	addSelectorFlags(cmd)
+}
+
+// getScanFlags returns the hosts selector, ports and options given by the
+// flags of addScanFlags
+func getScanFlags(cmd *cobra.Command) (scan.Selector, []int, scan.Options, error) {
+	sel, err := getSelector(cmd)
+	if err != nil {
+		return sel, nil, scan.Options{}, err
+	}
+	specs, err := cmd.Flags().GetStringSlice("ports")
+	if err != nil {
+		return sel, nil, scan.Options{}, err
+	}
+	exclude, err := cmd.Flags().GetStringSlice("exclude-ports")
+	if err != nil {
+		return sel, nil, scan.Options{}, err
+	}
+	top, err := cmd.Flags().GetInt("top-ports")
+	if err != nil {
+		return sel, nil, scan.Options{}, err
+	}
+	if err := scan.CheckTopPorts(top); err != nil {
+		return sel, nil, scan.Options{}, err
+	}
+	for _, p := range scan.TopPorts(top) {
+		specs = append(specs, strconv.Itoa(p))
+	}
+	ports, err := scan.ParsePorts(specs, exclude)
+	if err != nil {
+		return sel, nil, scan.Options{}, err
+	}
+
+	opts := scan.Options{}
+	if opts.Concurrency, err = cmd.Flags().GetInt("concurrency"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.HostRate, err = cmd.Flags().GetFloat64("rate"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.Protocol, err = cmd.Flags().GetString("protocol"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.Protocol != scan.TCP && opts.Protocol != scan.UDP {
+		return sel, nil, opts, fmt.Errorf("%w: %q", scan.ErrInvalidProtocol, opts.Protocol)
+	}
+	if opts.Timeout, err = cmd.Flags().GetDuration("timeout"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.Banners, err = cmd.Flags().GetBool("banners"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.Discovery, err = cmd.Flags().GetBool("discover"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.DiscoveryPorts, err = cmd.Flags().GetIntSlice("discovery-ports"); err != nil {
+		return sel, nil, opts, err
+	}
+	for _, p := range opts.DiscoveryPorts {
+		if p < scan.MinPort || p > scan.MaxPort {
+			return sel, nil, opts, fmt.Errorf("%w: discovery port %d", scan.ErrInvalidPort, p)
+		}
+	}
+	if opts.AllAddresses, err = cmd.Flags().GetBool("all-addresses"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.ReverseDNS, err = cmd.Flags().GetBool("reverse-dns"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.TLS, err = cmd.Flags().GetBool("tls"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.TLSPorts, err = cmd.Flags().GetIntSlice("tls-ports"); err != nil {
+		return sel, nil, opts, err
+	}
+	if opts.ExpiryDays, err = cmd.Flags().GetInt("expiry-days"); err != nil {
+		return sel, nil, opts, err
+	}
+	return sel, ports, opts, nil
+}
+
+// scanAction scans the hosts matching the selector and writes the results in
+// the format of cfg, recording them in the history file unless it is empty.
+// When ctx is done, it writes the partial results and returns the error of
+// ctx, leaving the history untouched.
+func scanAction(ctx context.Context, out io.Writer, cfg scanConfig) error {
 	hl := &scan.HostsList{}
-	if err := hl.Load(hostsFile); err != nil {
+	if err := hl.Load(cfg.hostsFile); err != nil {
 		return err
 	}
-	results := scan.Run(hl, ports)
-	return printResults(out, results)
+
+	opts := cfg.opts
+	if cfg.progress != nil {
+		opts.OnProgress = progressPrinter(cfg.progress, 100*time.Millisecond)
+	}
+	start := time.Now()
+	results, scanErr := scan.RunContext(ctx, hl.Select(cfg.sel), cfg.ports, opts)
+	if cfg.progress != nil {
+		// clear the progress line
+		fmt.Fprint(cfg.progress, "\r\033[K")
+	}
+	if scanErr != nil {
+		if err := writeResults(out, cfg.format, results, start); err != nil {
+			return err
+		}
+		return fmt.Errorf("scan interrupted, results are partial: %w", scanErr)
+	}
+
+	if cfg.historyFile != "" {
+		err := scan.UpdateHistory(cfg.historyFile, func(h *scan.History) {
+			h.Add(start, opts.Protocol, cfg.ports, results)
+			h.Trim(cfg.historySize)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writeResults(out, cfg.format, results, start)
+}
+
+// describeTLS returns the TLS session and certificate of a port on one line,
+// ending with the warnings on the certificate
+func describeTLS(info *scan.TLSInfo) string {
+	line := fmt.Sprintf("%s %s, subject %q, issuer %q", info.Version, info.CipherSuite, info.Subject, info.Issuer)
+	if len(info.SANs) > 0 {
+		line += ", SANs " + strings.Join(info.SANs, ",")
+	}
+	line += ", expires " + info.NotAfter.Format("2006-01-02")
+
+	warnings := []string{}
+	if info.SelfSigned {
+		warnings = append(warnings, "self-signed")
+	}
+	if info.Expired {
+		warnings = append(warnings, "expired")
+	}
+	if info.Expiring {
+		warnings = append(warnings, "expiring")
+	}
+	if len(warnings) > 0 {
+		line += fmt.Sprintf(" (%s)", strings.Join(warnings, ", "))
+	}
+	return line
+}
+
+// progressPrinter returns a progress callback rewriting the progress of the
+// scan on a single line of w, at most once every period
+func progressPrinter(w io.Writer, period time.Duration) func(scan.Progress) {
+	var last time.Time
+	return func(p scan.Progress) {
+		if time.Since(last) < period && p.HostsDone < p.Hosts {
+			return
+		}
+		last = time.Now()
+
+		percent := 0
+		if p.Probes > 0 {
+			percent = 100 * p.ProbesDone / p.Probes
+		}
+		fmt.Fprintf(w, "\r\033[KScanning: %d%% (%d/%d probes, %d/%d hosts done)",
+			percent, p.ProbesDone, p.Probes, p.HostsDone, p.Hosts)
+	}
 }
 
 func printResults(out io.Writer, results []scan.Results) error {
 	message := ""
 	for _, res := range results {
-		message += fmt.Sprintf("%s:", res.Host)
+		// the scanned address of multi-homed hosts tells the results apart
+		message += res.Host
+		if len(res.Addresses) > 1 && res.Address != "" {
+			message += fmt.Sprintf(" (%s)", res.Address)
+		}
+		message += ":"
 		if res.NotFound {
 			message += " Host not found\n\n"
 			continue
 		}
+		// the status is only known when the hosts were discovered
+		switch res.Status {
+		case scan.StatusDown:
+			message += fmt.Sprintf(" Host down (%s)", strings.Join(res.Addresses, ", "))
+		case scan.StatusUp:
+			message += fmt.Sprintf(" Host up (%s)", strings.Join(res.Addresses, ", "))
+		}
 		message += fmt.Sprintln()
+		if len(res.Names) > 0 {
+			message += fmt.Sprintf("\trDNS: %s\n", strings.Join(res.Names, ", "))
+		}
+		if res.Status == scan.StatusDown {
+			message += fmt.Sprintln()
+			continue
+		}
 		for _, ps := range res.PortStates {
-			message += fmt.Sprintf("\t%d: %s\n", ps.Port, ps.Open)
+			port := fmt.Sprint(ps.Port)
+			if ps.Protocol == scan.UDP {
+				port += "/" + scan.UDP
+			}
+			if ps.Service != "" {
+				port += fmt.Sprintf(" (%s)", ps.Service)
+			}
+			reason := ps.Reason
+			if ps.Latency > 0 {
+				reason += fmt.Sprintf(", %s", ps.Latency.Round(time.Microsecond))
+			}
+			if reason != "" {
+				reason = fmt.Sprintf(" (%s)", reason)
+			}
+			message += fmt.Sprintf("\t%s: %s%s", port, ps.State, reason)
+			switch {
+			case ps.Version != "":
+				message += fmt.Sprintf(" %s", ps.Version)
+			case ps.Banner != "":
+				message += fmt.Sprintf(" %q", ps.Banner)
+			}
+			message += fmt.Sprintln()
+			if ps.TLS != nil {
+				message += fmt.Sprintf("\t\t%s\n", describeTLS(ps.TLS))
+			}
 		}
 		message += fmt.Sprintln()
 	}
@@ -75,7 +367,10 @@ func printResults(out io.Writer, results []scan.Results) error {
 
 func init() {
 	rootCmd.AddCommand(scanCmd)
-	scanCmd.Flags().IntSliceP("ports", "p", []int{22, 80, 443}, "ports to scan")
+	addScanFlags(scanCmd)
+	scanCmd.Flags().StringP("output", "o", "text", "format of the results: "+strings.Join(outputFormats, ", "))
+	scanCmd.Flags().String("out-file", "", "file to write the results to instead of the standard output")
+	scanCmd.Flags().Bool("progress", true, "show the progress of the scan when the standard error is a terminal")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,141 @@
+/*
+Copyright © 2022 Bart Van Bos
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the hosts list and scans over an HTTP API",
+	Long: `Serves the hosts list and scans over an HTTP API, so that scans can be
+started remotely. The API exchanges JSON documents:
+
+  GET    /hosts                list the hosts, selected by the group and
+                               label=key=value query parameters
+  POST   /hosts                add a host, such as {"name": "host1", "groups": ["web"]}
+  DELETE /hosts/<host>         delete a host
+  GET    /scans                list the scans
+  POST   /scans                start a scan, such as {"ports": ["web"], "tls": true}
+  GET    /scans/<id>           get the status and progress of a scan
+  GET    /scans/<id>/results   get the results of a finished scan
+  DELETE /scans/<id>           cancel a running scan
+
+The hosts added through the API cannot be target files, and cannot expand to
+more than 1024 addresses.
+
+The scans take the options of the scan command flags, named in snake case such
+as top_ports, tls_ports or discovery_ports, and select the hosts with groups
+and labels, such as {"groups": ["web"], "labels": {"env": "prod"}}. A scan
+covers at most 1024 ports with at most 1024 parallel probes, and request bodies
+are limited to 1 MiB. The scans are recorded in the history once done, the
+server keeping the last 100 finished scans.
+
+The server stops on SIGINT or SIGTERM, cancelling the running scans.`,
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hostsFile := viper.GetString("hosts-file")
+		historyFile := viper.GetString("history-file")
+		historySize := viper.GetInt("history-size")
+		addr, err := cmd.Flags().GetString("addr")
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		return serveAction(ctx, os.Stdout, ln, hostsFile, historyFile, historySize)
+	},
+}
+
+// serveAction serves the API on ln until ctx is done, then waits for the
+// requests in progress to complete
+func serveAction(ctx context.Context, out io.Writer, ln net.Listener, hostsFile, historyFile string,
+	historySize int) error {
+	scans, cancelScans := context.WithCancel(context.Background())
+	defer cancelScans()
+
+	srv := &http.Server{
+		Handler:      newServer(scans, hostsFile, historyFile, historySize).newMux(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+	fmt.Fprintf(out, "Serving the pScan API on http://%s\n", ln.Addr())
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	cancelScans()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "Server stopped")
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// serveCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// serveCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	serveCmd.Flags().String("addr", "localhost:8080", "address to listen on")
+}
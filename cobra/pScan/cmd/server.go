@@ -0,0 +1,479 @@
+/*
+Copyright © 2022 Bart Van Bos
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+const (
+	// maxAPITargets is the maximum number of hosts an entry added through
+	// the API can expand to
+	maxAPITargets = 1024
+	// maxAPIPorts and maxAPIConcurrency bound the scans started through the
+	// API
+	maxAPIPorts       = 1024
+	maxAPIConcurrency = 1024
+	// maxBodySize is the maximum size of the request bodies, in bytes
+	maxBodySize = 1 << 20
+	// maxFinishedJobs is the number of finished scans the server keeps,
+	// forgetting the oldest ones
+	maxFinishedJobs = 100
+)
+
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobCancelled = "cancelled"
+)
+
+// job is a scan started through the API
+type job struct {
+	ID       int           `json:"id"`
+	Status   string        `json:"status"`
+	Started  time.Time     `json:"started"`
+	Finished *time.Time    `json:"finished,omitempty"`
+	Progress scan.Progress `json:"progress"`
+
+	results []scan.Results
+	cancel  context.CancelFunc
+}
+
+// scanRequest is the body of a request starting a scan, with the defaults of
+// the scan command flags
+type scanRequest struct {
+	Ports          []string          `json:"ports"`
+	ExcludePorts   []string          `json:"exclude_ports"`
+	TopPorts       int               `json:"top_ports"`
+	Protocol       string            `json:"protocol"`
+	Timeout        string            `json:"timeout"`
+	Concurrency    int               `json:"concurrency"`
+	Rate           float64           `json:"rate"`
+	Banners        bool              `json:"banners"`
+	Discover       bool              `json:"discover"`
+	AllAddresses   bool              `json:"all_addresses"`
+	ReverseDNS     bool              `json:"reverse_dns"`
+	TLS            bool              `json:"tls"`
+	TLSPorts       []int             `json:"tls_ports"`
+	ExpiryDays     int               `json:"expiry_days"`
+	DiscoveryPorts []int             `json:"discovery_ports"`
+	Groups         []string          `json:"groups"`
+	Labels         map[string]string `json:"labels"`
+}
+
+// options converts the request to the ports and options of a scan
+func (sr scanRequest) options() ([]int, scan.Options, error) {
+	specs := sr.Ports
+	if len(specs) == 0 {
+		specs = []string{"22", "80", "443"}
+	}
+	if err := scan.CheckTopPorts(sr.TopPorts); err != nil {
+		return nil, scan.Options{}, err
+	}
+	for _, p := range scan.TopPorts(sr.TopPorts) {
+		specs = append(specs, strconv.Itoa(p))
+	}
+	ports, err := scan.ParsePorts(specs, sr.ExcludePorts)
+	if err != nil {
+		return nil, scan.Options{}, err
+	}
+	if len(ports) > maxAPIPorts {
+		return nil, scan.Options{}, fmt.Errorf("%w: %d ports, at most %d can be scanned", scan.ErrInvalidPort,
+			len(ports), maxAPIPorts)
+	}
+	if sr.Concurrency > maxAPIConcurrency {
+		return nil, scan.Options{}, fmt.Errorf("invalid concurrency %d: at most %d", sr.Concurrency, maxAPIConcurrency)
+	}
+
+	opts := scan.Options{
+		Concurrency:    sr.Concurrency,
+		HostRate:       sr.Rate,
+		Protocol:       sr.Protocol,
+		Banners:        sr.Banners,
+		Discovery:      sr.Discover,
+		AllAddresses:   sr.AllAddresses,
+		ReverseDNS:     sr.ReverseDNS,
+		TLS:            sr.TLS,
+		TLSPorts:       sr.TLSPorts,
+		ExpiryDays:     sr.ExpiryDays,
+		DiscoveryPorts: sr.DiscoveryPorts,
+	}
+	if opts.Protocol == "" {
+		opts.Protocol = scan.TCP
+	}
+	if opts.Protocol != scan.TCP && opts.Protocol != scan.UDP {
+		return nil, opts, fmt.Errorf("%w: %q", scan.ErrInvalidProtocol, opts.Protocol)
+	}
+	if sr.Timeout != "" {
+		if opts.Timeout, err = time.ParseDuration(sr.Timeout); err != nil {
+			return nil, opts, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	for _, p := range opts.DiscoveryPorts {
+		if p < scan.MinPort || p > scan.MaxPort {
+			return nil, opts, fmt.Errorf("%w: discovery port %d", scan.ErrInvalidPort, p)
+		}
+	}
+	return ports, opts, nil
+}
+
+// checkTarget rejects the entries the API does not add: the target files,
+// which would let the clients read the files of the server, and the entries
+// expanding to more than maxAPITargets hosts
+func checkTarget(name string) error {
+	if strings.HasPrefix(name, "@") {
+		return fmt.Errorf("%w: target files cannot be added through the API: %s", scan.ErrInvalidTarget, name)
+	}
+	if !scan.IsExpandable(name) {
+		return nil
+	}
+	hosts, err := scan.ExpandTarget(name)
+	if err != nil {
+		return err
+	}
+	if len(hosts) > maxAPITargets {
+		return fmt.Errorf("%w: %s has more than %d addresses", scan.ErrTooManyTargets, name, maxAPITargets)
+	}
+	return nil
+}
+
+// server serves the hosts list and the scans over HTTP
+type server struct {
+	hostsFile   string
+	historyFile string
+	historySize int
+	// ctx is the parent of the scans, cancelled when the server stops
+	ctx context.Context
+
+	// mu guards the hosts file and the jobs
+	mu     sync.Mutex
+	jobs   []*job
+	nextID int
+}
+
+func newServer(ctx context.Context, hostsFile, historyFile string, historySize int) *server {
+	return &server{hostsFile: hostsFile, historyFile: historyFile, historySize: historySize, ctx: ctx, nextID: 1}
+}
+
+// newMux returns the HTTP API of the server
+func (s *server) newMux() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/hosts", s.hostsHandler)
+	m.Handle("/hosts/", http.StripPrefix("/hosts/", http.HandlerFunc(s.hostHandler)))
+	m.HandleFunc("/scans", s.scansHandler)
+	m.Handle("/scans/", http.StripPrefix("/scans/", http.HandlerFunc(s.scanHandler)))
+	return m
+}
+
+func replyJSON(w http.ResponseWriter, status int, content interface{}) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+	w.Write([]byte("\n"))
+}
+
+// replyError replies with the status matching err and its message as JSON
+func replyError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadRequest
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, scan.ErrExists):
+		status = http.StatusConflict
+	case errors.Is(err, scan.ErrNotExists), errors.Is(err, scan.ErrScanNotExists):
+		status = http.StatusNotFound
+	}
+	log.Printf("%s %s: Error: %d %s", r.Method, r.URL, status, err)
+	replyJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// hostsHandler lists the hosts, selected by the group and label query
+// parameters, and adds hosts
+func (s *server) hostsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		labels, err := scan.ParseLabels(r.URL.Query()["label"])
+		if err != nil {
+			replyError(w, r, err)
+			return
+		}
+		sel := scan.Selector{Groups: r.URL.Query()["group"], Labels: labels}
+
+		s.mu.Lock()
+		hl := &scan.HostsList{}
+		err = hl.Load(s.hostsFile)
+		s.mu.Unlock()
+		if err != nil {
+			replyError(w, r, err)
+			return
+		}
+		hosts := hl.Select(sel).Hosts
+		if hosts == nil {
+			hosts = []scan.Host{}
+		}
+		replyJSON(w, http.StatusOK, struct {
+			Hosts []scan.Host `json:"hosts"`
+		}{hosts})
+	case http.MethodPost:
+		var h scan.Host
+		body := http.MaxBytesReader(w, r.Body, maxBodySize)
+		if err := json.NewDecoder(body).Decode(&h); err != nil {
+			replyError(w, r, fmt.Errorf("invalid host: %w", err))
+			return
+		}
+		if err := checkTarget(h.Name); err != nil {
+			replyError(w, r, err)
+			return
+		}
+
+		s.mu.Lock()
+		err := addAction(io.Discard, s.hostsFile, []string{h.Name}, h)
+		s.mu.Unlock()
+		if err != nil {
+			replyError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", "/hosts/"+h.Name)
+		replyJSON(w, http.StatusCreated, h)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// hostHandler deletes the host named by the path
+func (s *server) hostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	s.mu.Lock()
+	err := deleteAction(io.Discard, s.hostsFile, []string{r.URL.Path})
+	s.mu.Unlock()
+	if err != nil {
+		replyError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scansHandler lists the jobs and starts scans
+func (s *server) scansHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		jobs := make([]job, 0, len(s.jobs))
+		for _, j := range s.jobs {
+			jobs = append(jobs, *j)
+		}
+		s.mu.Unlock()
+		replyJSON(w, http.StatusOK, struct {
+			Scans []job `json:"scans"`
+		}{jobs})
+	case http.MethodPost:
+		var sr scanRequest
+		if r.ContentLength != 0 {
+			body := http.MaxBytesReader(w, r.Body, maxBodySize)
+			if err := json.NewDecoder(body).Decode(&sr); err != nil {
+				replyError(w, r, fmt.Errorf("invalid scan request: %w", err))
+				return
+			}
+		}
+		ports, opts, err := sr.options()
+		if err != nil {
+			replyError(w, r, err)
+			return
+		}
+
+		j, err := s.start(scan.Selector{Groups: sr.Groups, Labels: sr.Labels}, ports, opts)
+		if err != nil {
+			replyError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/scans/%d", j.ID))
+		replyJSON(w, http.StatusAccepted, j)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// scanHandler returns the status of the job of the path, its results on the
+// results subpath, or cancels it
+func (s *server) scanHandler(w http.ResponseWriter, r *http.Request) {
+	id, sub, _ := strings.Cut(r.URL.Path, "/")
+	n, err := strconv.Atoi(id)
+	if err != nil || (sub != "" && sub != "results") {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	j, err := s.job(n)
+	var snapshot job
+	if err == nil {
+		snapshot = *j
+	}
+	s.mu.Unlock()
+	if err != nil {
+		replyError(w, r, err)
+		return
+	}
+
+	switch {
+	case sub == "results" && r.Method == http.MethodGet:
+		if snapshot.Status == jobRunning {
+			replyJSON(w, http.StatusConflict, struct {
+				Error string `json:"error"`
+			}{"scan still running"})
+			return
+		}
+		results := snapshot.results
+		if results == nil {
+			results = []scan.Results{}
+		}
+		replyJSON(w, http.StatusOK, struct {
+			Results []scan.Results `json:"results"`
+		}{results})
+	case sub == "results":
+		methodNotAllowed(w, http.MethodGet)
+	case r.Method == http.MethodGet:
+		replyJSON(w, http.StatusOK, snapshot)
+	case r.Method == http.MethodDelete:
+		snapshot.cancel()
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// job returns the job with the given ID, with s.mu held
+func (s *server) job(id int) (*job, error) {
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", scan.ErrScanNotExists, id)
+}
+
+// prune forgets the oldest finished jobs beyond maxFinishedJobs, with s.mu
+// held
+func (s *server) prune() {
+	finished := 0
+	for _, j := range s.jobs {
+		if j.Status != jobRunning {
+			finished++
+		}
+	}
+
+	jobs := s.jobs[:0]
+	for _, j := range s.jobs {
+		if j.Status != jobRunning && finished > maxFinishedJobs {
+			finished--
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	for i := len(jobs); i < len(s.jobs); i++ {
+		s.jobs[i] = nil
+	}
+	s.jobs = jobs
+}
+
+// start runs a scan of the hosts matching sel in the background, recording
+// its results in the history once done and keeping the job until
+// maxFinishedJobs newer ones are finished
+func (s *server) start(sel scan.Selector, ports []int, opts scan.Options) (job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hl := &scan.HostsList{}
+	if err := hl.Load(s.hostsFile); err != nil {
+		return job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	j := &job{ID: s.nextID, Status: jobRunning, Started: time.Now(), cancel: cancel}
+	s.nextID++
+	s.jobs = append(s.jobs, j)
+
+	opts.OnProgress = func(p scan.Progress) {
+		s.mu.Lock()
+		j.Progress = p
+		s.mu.Unlock()
+	}
+
+	go func() {
+		defer cancel()
+		results, err := scan.RunContext(ctx, hl.Select(sel), ports, opts)
+
+		// the history file is shared with the other pScan processes, it is
+		// written before the job is done but without holding s.mu as it may
+		// have to wait for them
+		if err == nil && s.historyFile != "" {
+			herr := scan.UpdateHistory(s.historyFile, func(h *scan.History) {
+				h.Add(j.Started, opts.Protocol, ports, results)
+				h.Trim(s.historySize)
+			})
+			if herr != nil {
+				log.Printf("scan %d: recording history: %s", j.ID, herr)
+			}
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		j.Finished = &now
+		j.results = results
+		j.Status = jobDone
+		if err != nil {
+			j.Status = jobCancelled
+		}
+		s.prune()
+	}()
+	return *j, nil
+}
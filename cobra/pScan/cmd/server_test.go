@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+// do sends a request to the test server, decoding the JSON response into v
+// if not nil
+func do(t *testing.T, method, url, body string, v interface{}) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func TestServerHosts(t *testing.T) {
+	tf, cleanup := setup(t, []string{"host1"}, true)
+	defer cleanup()
+
+	ts := httptest.NewServer(newServer(context.Background(), tf, "", 0).newMux())
+	defer ts.Close()
+
+	testCases := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		expStatus int
+	}{
+		{name: "Add", method: http.MethodPost, path: "/hosts",
+			body: `{"name": "10.0.0.0/28", "groups": ["db"], "labels": {"env": "prod"}}`, expStatus: http.StatusCreated},
+		{name: "AddExisting", method: http.MethodPost, path: "/hosts", body: `{"name": "host1"}`,
+			expStatus: http.StatusConflict},
+		{name: "AddInvalid", method: http.MethodPost, path: "/hosts", body: `{"name": "10.0.0.20-1"}`,
+			expStatus: http.StatusBadRequest},
+		{name: "AddTargetFile", method: http.MethodPost, path: "/hosts", body: `{"name": "@/etc/passwd"}`,
+			expStatus: http.StatusBadRequest},
+		{name: "AddTooManyTargets", method: http.MethodPost, path: "/hosts", body: `{"name": "10.0.0.0/16"}`,
+			expStatus: http.StatusBadRequest},
+		{name: "AddMalformed", method: http.MethodPost, path: "/hosts", body: `{"name":`,
+			expStatus: http.StatusBadRequest},
+		{name: "DeleteNotExists", method: http.MethodDelete, path: "/hosts/host3", expStatus: http.StatusNotFound},
+		{name: "AddTooLarge", method: http.MethodPost, path: "/hosts",
+			body:      `{"name": "host2", "comment": "` + strings.Repeat("a", maxBodySize) + `"}`,
+			expStatus: http.StatusRequestEntityTooLarge},
+		{name: "MethodNotAllowed", method: http.MethodPut, path: "/hosts", expStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := do(t, tc.method, ts.URL+tc.path, tc.body, nil)
+			if resp.StatusCode != tc.expStatus {
+				t.Errorf("expected status %d, got %d instead\n", tc.expStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	var list struct {
+		Hosts []scan.Host `json:"hosts"`
+	}
+	do(t, http.MethodGet, ts.URL+"/hosts?group=db&label=env=prod", "", &list)
+	if len(list.Hosts) != 1 || list.Hosts[0].Name != "10.0.0.0/28" || list.Hosts[0].Labels["env"] != "prod" {
+		t.Errorf("expected the db host, got %+v instead\n", list.Hosts)
+	}
+
+	if resp := do(t, http.MethodDelete, ts.URL+"/hosts/10.0.0.0/28", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d instead\n", http.StatusNoContent, resp.StatusCode)
+	}
+	do(t, http.MethodGet, ts.URL+"/hosts", "", &list)
+	if len(list.Hosts) != 1 || list.Hosts[0].Name != "host1" {
+		t.Errorf("expected only host1 left, got %+v instead\n", list.Hosts)
+	}
+}
+
+// waitJob polls a scan until it is no longer running
+func waitJob(t *testing.T, url string) job {
+	t.Helper()
+	var j job
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		do(t, http.MethodGet, url, "", &j)
+		if j.Status != jobRunning {
+			return j
+		}
+	}
+	t.Fatalf("scan %s still running", url)
+	return j
+}
+
+func TestServerScans(t *testing.T) {
+	tf, cleanup := setup(t, []string{"127.0.0.1"}, true)
+	defer cleanup()
+	hf, hfCleanup := setup(t, nil, false)
+	defer hfCleanup()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ts := httptest.NewServer(newServer(context.Background(), tf, hf, 0).newMux())
+	defer ts.Close()
+
+	t.Run("Scan", func(t *testing.T) {
+		var started job
+		resp := do(t, http.MethodPost, ts.URL+"/scans", fmt.Sprintf(`{"ports": ["%d"], "timeout": "500ms"}`, port), &started)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d instead\n", http.StatusAccepted, resp.StatusCode)
+		}
+		location := resp.Header.Get("Location")
+		if location != fmt.Sprintf("/scans/%d", started.ID) {
+			t.Errorf("expected location of scan %d, got %q instead\n", started.ID, location)
+		}
+
+		j := waitJob(t, ts.URL+location)
+		expProgress := scan.Progress{HostsDone: 1, Hosts: 1, ProbesDone: 1, Probes: 1}
+		if j.Status != jobDone || j.Finished == nil || j.Progress != expProgress {
+			t.Errorf("expected scan done with progress %+v, got %+v instead\n", expProgress, j)
+		}
+
+		var res struct {
+			Results []scan.Results `json:"results"`
+		}
+		do(t, http.MethodGet, ts.URL+location+"/results", "", &res)
+		if len(res.Results) != 1 || len(res.Results[0].PortStates) != 1 ||
+			res.Results[0].PortStates[0].State != scan.StateOpen {
+			t.Errorf("expected port %d open, got %+v instead\n", port, res.Results)
+		}
+
+		h := &scan.History{}
+		if err := h.Load(hf); err != nil {
+			t.Fatal(err)
+		}
+		if len(h.Records) != 1 {
+			t.Errorf("expected scan recorded in history, got %d records instead\n", len(h.Records))
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		var started job
+		do(t, http.MethodPost, ts.URL+"/scans", `{"ports": ["1-100"], "rate": 1}`, &started)
+		location := fmt.Sprintf("%s/scans/%d", ts.URL, started.ID)
+
+		if resp := do(t, http.MethodGet, location+"/results", "", nil); resp.StatusCode != http.StatusConflict {
+			t.Errorf("expected status %d while running, got %d instead\n", http.StatusConflict, resp.StatusCode)
+		}
+		if resp := do(t, http.MethodDelete, location, "", nil); resp.StatusCode != http.StatusAccepted {
+			t.Errorf("expected status %d, got %d instead\n", http.StatusAccepted, resp.StatusCode)
+		}
+		if j := waitJob(t, location); j.Status != jobCancelled {
+			t.Errorf("expected scan cancelled, got %q instead\n", j.Status)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		var list struct {
+			Scans []job `json:"scans"`
+		}
+		do(t, http.MethodGet, ts.URL+"/scans", "", &list)
+		if len(list.Scans) != 2 || list.Scans[0].ID != 1 || list.Scans[1].ID != 2 {
+			t.Errorf("expected scans 1 and 2, got %+v instead\n", list.Scans)
+		}
+	})
+
+	errCases := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		expStatus int
+	}{
+		{name: "InvalidPorts", method: http.MethodPost, path: "/scans", body: `{"ports": ["0"]}`,
+			expStatus: http.StatusBadRequest},
+		{name: "InvalidProtocol", method: http.MethodPost, path: "/scans", body: `{"protocol": "sctp"}`,
+			expStatus: http.StatusBadRequest},
+		{name: "InvalidTimeout", method: http.MethodPost, path: "/scans", body: `{"timeout": "soon"}`,
+			expStatus: http.StatusBadRequest},
+		{name: "TooManyPorts", method: http.MethodPost, path: "/scans", body: `{"ports": ["1-2000"]}`,
+			expStatus: http.StatusBadRequest},
+		{name: "TooManyWorkers", method: http.MethodPost, path: "/scans", body: `{"concurrency": 100000}`,
+			expStatus: http.StatusBadRequest},
+		{name: "TooManyTopPorts", method: http.MethodPost, path: "/scans", body: `{"top_ports": 1000}`,
+			expStatus: http.StatusBadRequest},
+		{name: "InvalidDiscoveryPorts", method: http.MethodPost, path: "/scans", body: `{"discovery_ports": [70000]}`,
+			expStatus: http.StatusBadRequest},
+		{name: "NotExists", method: http.MethodGet, path: "/scans/42", expStatus: http.StatusNotFound},
+		{name: "InvalidID", method: http.MethodGet, path: "/scans/last", expStatus: http.StatusNotFound},
+		{name: "InvalidSubpath", method: http.MethodGet, path: "/scans/1/logs", expStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range errCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := do(t, tc.method, ts.URL+tc.path, tc.body, nil)
+			if resp.StatusCode != tc.expStatus {
+				t.Errorf("expected status %d, got %d instead\n", tc.expStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServeAction(t *testing.T) {
+	tf, cleanup := setup(t, []string{"host1"}, true)
+	defer cleanup()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	errCh := make(chan error)
+	go func() {
+		errCh <- serveAction(ctx, &out, ln, tf, "", 0)
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "host1") {
+		t.Errorf("expected hosts list, got %d %q instead\n", resp.StatusCode, body)
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+	expOut := fmt.Sprintf("Serving the pScan API on http://%s\nServer stopped\n", ln.Addr())
+	if out.String() != expOut {
+		t.Errorf("expected output %q, got %q instead\n", expOut, out.String())
+	}
+}
+
+func TestScanRequestOptions(t *testing.T) {
+	sr := scanRequest{TLSPorts: []int{8443}, ExpiryDays: 7, DiscoveryPorts: []int{22}}
+	_, opts, err := sr.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.TLSPorts) != 1 || opts.TLSPorts[0] != 8443 || opts.ExpiryDays != 7 ||
+		len(opts.DiscoveryPorts) != 1 || opts.DiscoveryPorts[0] != 22 {
+		t.Errorf("expected the TLS and discovery options of the request, got %+v instead\n", opts)
+	}
+}
+
+func TestServerPrune(t *testing.T) {
+	s := newServer(context.Background(), "", "", 0)
+	s.jobs = append(s.jobs, &job{ID: 1, Status: jobRunning})
+	for id := 2; id <= maxFinishedJobs+3; id++ {
+		s.jobs = append(s.jobs, &job{ID: id, Status: jobDone})
+	}
+
+	s.prune()
+	if len(s.jobs) != maxFinishedJobs+1 {
+		t.Fatalf("expected %d jobs, got %d instead\n", maxFinishedJobs+1, len(s.jobs))
+	}
+	if s.jobs[0].ID != 1 || s.jobs[1].ID != 4 {
+		t.Errorf("expected the running job and the newest finished ones, got %d and %d instead\n",
+			s.jobs[0].ID, s.jobs[1].ID)
+	}
+}
@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxBannerLen is the number of characters of a banner kept in the results
+const maxBannerLen = 128
+
+// cleanBanner keeps the first line of a banner without its control
+// characters, truncated to maxBannerLen characters
+func cleanBanner(line string) string {
+	line, _, _ = strings.Cut(line, "\n")
+	line = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, line)
+	line = strings.TrimSpace(line)
+
+	if r := []rune(line); len(r) > maxBannerLen {
+		line = string(r[:maxBannerLen])
+	}
+	return line
+}
+
+// parseBanner identifies the service and its version from the greeting a
+// server sends on connection
+func parseBanner(banner string) (service, version string) {
+	switch {
+	case strings.HasPrefix(banner, "SSH-"):
+		// SSH-protoversion-softwareversion comments
+		parts := strings.SplitN(banner, "-", 3)
+		if len(parts) == 3 {
+			return "ssh", parts[2]
+		}
+		return "ssh", ""
+	case strings.HasPrefix(banner, "220"):
+		text := strings.TrimSpace(strings.TrimLeft(banner[3:], " -"))
+		upper := strings.ToUpper(text)
+		for _, marker := range []string{"ESMTP", "SMTP"} {
+			if i := strings.Index(upper, marker); i >= 0 {
+				return "smtp", strings.TrimSpace(text[i+len(marker):])
+			}
+		}
+		// FTP servers name themselves in the greeting, often in parentheses
+		if strings.Contains(upper, "FTP") {
+			return "ftp", strings.Trim(text, "()")
+		}
+	}
+	return "", ""
+}
+
+// grabBanner reads the greeting of the server on conn, or probes it with an
+// HTTP HEAD request when it waits for the client to speak first. It returns
+// the service and version it identified along with the raw banner.
+func grabBanner(conn net.Conn, host string, timeout time.Duration) (service, version, banner string) {
+	r := bufio.NewReader(conn)
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	line, err := r.ReadString('\n')
+	if line != "" {
+		banner = cleanBanner(line)
+		service, version = parseBanner(banner)
+		if service == "smtp" {
+			conn.Write([]byte("QUIT\r\n"))
+		}
+		return service, version, banner
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return "", "", ""
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	probe := "HEAD / HTTP/1.0\r\nHost: " + host + "\r\nUser-Agent: pScan\r\n\r\n"
+	if _, err := conn.Write([]byte(probe)); err != nil {
+		return "", "", ""
+	}
+
+	status, err := r.ReadString('\n')
+	if !strings.HasPrefix(status, "HTTP/") {
+		return "", "", cleanBanner(status)
+	}
+	banner = cleanBanner(status)
+	for err == nil {
+		var line string
+		line, err = r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(k, "Server") {
+			version = cleanBanner(v)
+		}
+	}
+	return "http", version, banner
+}
@@ -0,0 +1,124 @@
+package scan_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+// greetingServer starts a local TCP server sending greeting on every
+// connection, and returns its port
+func greetingServer(t *testing.T, greeting string) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if greeting != "" {
+					conn.Write([]byte(greeting))
+				}
+				// wait for the client to hang up
+				bufio.NewReader(conn).ReadString(0)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestRunBanners(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "fake-httpd/2.4.1")
+	}))
+	defer httpServer.Close()
+
+	testCases := []struct {
+		name       string
+		port       func(t *testing.T) int
+		expService string
+		expVersion string
+		expBanner  string
+	}{
+		{name: "SSH",
+			port:       func(t *testing.T) int { return greetingServer(t, "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3\r\n") },
+			expService: "ssh", expVersion: "OpenSSH_8.9p1 Ubuntu-3",
+			expBanner: "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3"},
+		{name: "SMTP",
+			port:       func(t *testing.T) int { return greetingServer(t, "220 mail.example.com ESMTP Postfix (Ubuntu)\r\n") },
+			expService: "smtp", expVersion: "Postfix (Ubuntu)",
+			expBanner: "220 mail.example.com ESMTP Postfix (Ubuntu)"},
+		{name: "FTP",
+			port:       func(t *testing.T) int { return greetingServer(t, "220 (vsFTPd 3.0.5)\r\n") },
+			expService: "ftp", expVersion: "vsFTPd 3.0.5",
+			expBanner: "220 (vsFTPd 3.0.5)"},
+		{name: "HTTP",
+			port:       func(t *testing.T) int { return httpServer.Listener.Addr().(*net.TCPAddr).Port },
+			expService: "http", expVersion: "fake-httpd/2.4.1",
+			expBanner: "HTTP/1.0 200 OK"},
+		{name: "Unknown",
+			port:      func(t *testing.T) int { return greetingServer(t, "hello\x00 there\r\nmore\r\n") },
+			expBanner: "hello there"},
+		{name: "Silent",
+			port: func(t *testing.T) int { return greetingServer(t, "") }},
+	}
+
+	hl := &scan.HostsList{}
+	hl.Add("127.0.0.1")
+
+	ports := []int{}
+	for _, tc := range testCases {
+		ports = append(ports, tc.port(t))
+	}
+
+	res := scan.Run(hl, ports, scan.Options{Banners: true, Timeout: 300 * time.Millisecond})
+
+	if len(res) != 1 || len(res[0].PortStates) != len(testCases) {
+		t.Fatalf("expected 1 result with %d port states, got %+v instead", len(testCases), res)
+	}
+	for i, tc := range testCases {
+		ps := res[0].PortStates[i]
+		if ps.State != scan.StateOpen {
+			t.Errorf("%s: expected port to be open, got %s instead", tc.name, ps.State)
+		}
+		if ps.Service != tc.expService || ps.Version != tc.expVersion {
+			t.Errorf("%s: expected %q %q, got %q %q instead", tc.name, tc.expService, tc.expVersion, ps.Service, ps.Version)
+		}
+		if ps.Banner != tc.expBanner {
+			t.Errorf("%s: expected banner %q, got %q instead", tc.name, tc.expBanner, ps.Banner)
+		}
+	}
+
+	// banners are only grabbed on request
+	res = scan.Run(hl, ports[:1], scan.Options{})
+	if ps := res[0].PortStates[0]; ps.Banner != "" || ps.Version != "" {
+		t.Errorf("expected no banner, got %q %q instead", ps.Banner, ps.Version)
+	}
+}
+
+func TestBannerLength(t *testing.T) {
+	hl := &scan.HostsList{}
+	hl.Add("127.0.0.1")
+
+	port := greetingServer(t, strings.Repeat("x", 500)+"\n")
+	res := scan.Run(hl, []int{port}, scan.Options{Banners: true})
+
+	if b := res[0].PortStates[0].Banner; len(b) != 128 {
+		t.Errorf("expected banner truncated to 128 characters, got %d instead", len(b))
+	}
+}
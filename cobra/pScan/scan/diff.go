@@ -0,0 +1,170 @@
+package scan
+
+import "fmt"
+
+const (
+	HostAppeared changeKind = iota
+	HostDisappeared
+	PortOpened
+	PortClosed
+	// PortChanged is a port going from a state other than open to another
+	// one, such as from closed to filtered
+	PortChanged
+)
+
+type changeKind int
+
+func (k changeKind) String() string {
+	switch k {
+	case HostAppeared:
+		return "appeared"
+	case HostDisappeared:
+		return "disappeared"
+	case PortOpened:
+		return "opened"
+	case PortClosed:
+		return "closed"
+	case PortChanged:
+		return "changed"
+	}
+	return fmt.Sprintf("changeKind(%d)", int(k))
+}
+
+func (k changeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Change is a difference between two scans. Address is only set for the
+// hosts scanned on several addresses, Port and Protocol for the changes of
+// ports, and From and To for the ports that changed state.
+type Change struct {
+	Host     string     `json:"host"`
+	Address  string     `json:"address,omitempty"`
+	Kind     changeKind `json:"change"`
+	Port     int        `json:"port,omitempty"`
+	Protocol string     `json:"protocol,omitempty"`
+	Service  string     `json:"service,omitempty"`
+	From     string     `json:"from,omitempty"`
+	To       string     `json:"to,omitempty"`
+}
+
+// String describes the change on a line starting with + for the hosts that
+// appeared and the ports that were opened, ~ for the ports that changed
+// state and - for the others
+func (c Change) String() string {
+	sign := "+"
+	switch c.Kind {
+	case HostDisappeared, PortClosed:
+		sign = "-"
+	case PortChanged:
+		sign = "~"
+	}
+	host := c.Host
+	if c.Address != "" {
+		host += fmt.Sprintf(" (%s)", c.Address)
+	}
+	if c.Port == 0 {
+		return fmt.Sprintf("%s %s: host %s", sign, host, c.Kind)
+	}
+	port := fmt.Sprintf("%d/%s", c.Port, c.Protocol)
+	if c.Service != "" {
+		port += fmt.Sprintf(" (%s)", c.Service)
+	}
+	if c.Kind == PortChanged {
+		return fmt.Sprintf("%s %s: %s changed from %s to %s", sign, host, port, c.From, c.To)
+	}
+	return fmt.Sprintf("%s %s: %s %s", sign, host, port, c.Kind)
+}
+
+// target identifies the results of a host, by its name and the scanned
+// address when the host was scanned on several addresses, so that the scans
+// of the first address of a host compare whatever address comes first
+type target struct {
+	host    string
+	address string
+}
+
+// targets returns the target of every results
+func targets(results []Results) []target {
+	count := make(map[string]int)
+	for _, res := range results {
+		count[res.Host]++
+	}
+	ts := make([]target, len(results))
+	for i, res := range results {
+		ts[i] = target{host: res.Host}
+		if count[res.Host] > 1 {
+			ts[i].address = res.Address
+		}
+	}
+	return ts
+}
+
+// portKey identifies a port scanned on a target
+type portKey struct {
+	target
+	protocol string
+	port     int
+}
+
+// Diff returns the hosts that appeared or disappeared between the from and to
+// scans, and the ports that were opened, closed or changed state. A host
+// appears when it is found and not down in the to scan only, and its open
+// ports count as opened. A port is only reported closed when the to scan
+// checked it, and changed when both scans checked it. The addresses
+// of the hosts scanned on several of them are compared as separate hosts.
+func Diff(from, to []Results) []Change {
+	fromTargets, toTargets := targets(from), targets(to)
+	found := func(results []Results, ts []target) map[target]bool {
+		hosts := make(map[target]bool)
+		for i, res := range results {
+			if !res.NotFound && res.Status != StatusDown {
+				hosts[ts[i]] = true
+			}
+		}
+		return hosts
+	}
+	fromHosts, toHosts := found(from, fromTargets), found(to, toTargets)
+
+	fromStates := make(map[portKey]state)
+	for i, res := range from {
+		for _, ps := range res.PortStates {
+			fromStates[portKey{fromTargets[i], ps.Protocol, ps.Port}] = ps.State
+		}
+	}
+
+	changes := []Change{}
+	for i, res := range to {
+		t := toTargets[i]
+		if !toHosts[t] {
+			continue
+		}
+		if !fromHosts[t] {
+			changes = append(changes, Change{Host: t.host, Address: t.address, Kind: HostAppeared})
+		}
+		for _, ps := range res.PortStates {
+			was, scanned := fromStates[portKey{t, ps.Protocol, ps.Port}]
+			c := Change{Host: t.host, Address: t.address,
+				Port: ps.Port, Protocol: ps.Protocol, Service: ps.Service}
+			switch {
+			case ps.State == StateOpen && (!scanned || was != StateOpen):
+				c.Kind = PortOpened
+			case ps.State != StateOpen && scanned && was == StateOpen:
+				c.Kind = PortClosed
+			case scanned && was != ps.State:
+				c.Kind = PortChanged
+				c.From, c.To = was.String(), ps.State.String()
+			default:
+				continue
+			}
+			changes = append(changes, c)
+		}
+	}
+
+	for _, t := range fromTargets {
+		if fromHosts[t] && !toHosts[t] {
+			changes = append(changes, Change{Host: t.host, Address: t.address, Kind: HostDisappeared})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,120 @@
+package scan_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+func TestDiff(t *testing.T) {
+	port := func(p int, s scan.PortState) scan.PortState {
+		s.Port, s.Protocol = p, scan.TCP
+		return s
+	}
+	open := scan.PortState{State: scan.StateOpen}
+	closed := scan.PortState{State: scan.StateClosed}
+	filtered := scan.PortState{State: scan.StateFiltered}
+
+	testCases := []struct {
+		name     string
+		from, to []scan.Results
+		expected []scan.Change
+	}{
+		{name: "NoChanges",
+			from:     []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, open), port(80, closed)}}},
+			to:       []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, open), port(80, closed)}}},
+			expected: []scan.Change{}},
+		{name: "PortsOpenedClosed",
+			from: []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, open), port(80, closed)}}},
+			to:   []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, closed), port(80, open)}}},
+			expected: []scan.Change{
+				{Host: "host1", Kind: scan.PortClosed, Port: 22, Protocol: scan.TCP},
+				{Host: "host1", Kind: scan.PortOpened, Port: 80, Protocol: scan.TCP},
+			}},
+		{name: "PortsChanged",
+			from: []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, closed), port(80, filtered), port(443, open)}}},
+			to:   []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, filtered), port(80, open), port(443, filtered)}}},
+			expected: []scan.Change{
+				{Host: "host1", Kind: scan.PortChanged, Port: 22, Protocol: scan.TCP, From: "closed", To: "filtered"},
+				{Host: "host1", Kind: scan.PortOpened, Port: 80, Protocol: scan.TCP},
+				{Host: "host1", Kind: scan.PortClosed, Port: 443, Protocol: scan.TCP},
+			}},
+		{name: "PortNotScanned",
+			from:     []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, open)}}},
+			to:       []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(80, closed)}}},
+			expected: []scan.Change{}},
+		{name: "HostAppeared",
+			from: []scan.Results{{Host: "host1", NotFound: true}},
+			to: []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, open), port(80, closed)}},
+				{Host: "host2", PortStates: []scan.PortState{port(22, closed)}}},
+			expected: []scan.Change{
+				{Host: "host1", Kind: scan.HostAppeared},
+				{Host: "host1", Kind: scan.PortOpened, Port: 22, Protocol: scan.TCP},
+				{Host: "host2", Kind: scan.HostAppeared},
+			}},
+		{name: "HostDown",
+			from: []scan.Results{{Host: "host1", Status: scan.StatusUp, PortStates: []scan.PortState{port(22, open)}}},
+			to:   []scan.Results{{Host: "host1", Status: scan.StatusDown}},
+			expected: []scan.Change{
+				{Host: "host1", Kind: scan.HostDisappeared},
+			}},
+		{name: "HostDisappeared",
+			from: []scan.Results{{Host: "host1", PortStates: []scan.PortState{port(22, open)}},
+				{Host: "host2", PortStates: []scan.PortState{port(22, open)}}},
+			to: []scan.Results{{Host: "host1", NotFound: true}},
+			expected: []scan.Change{
+				{Host: "host1", Kind: scan.HostDisappeared},
+				{Host: "host2", Kind: scan.HostDisappeared},
+			}},
+		{name: "FirstAddressChanged",
+			from:     []scan.Results{{Host: "host1", Address: "10.0.0.1", PortStates: []scan.PortState{port(22, open)}}},
+			to:       []scan.Results{{Host: "host1", Address: "10.0.0.2", PortStates: []scan.PortState{port(22, open)}}},
+			expected: []scan.Change{}},
+		{name: "AllAddresses",
+			from: []scan.Results{{Host: "host1", Address: "10.0.0.1", PortStates: []scan.PortState{port(22, open)}},
+				{Host: "host1", Address: "10.0.0.2", PortStates: []scan.PortState{port(22, closed)}}},
+			to: []scan.Results{{Host: "host1", Address: "10.0.0.1", PortStates: []scan.PortState{port(22, closed)}},
+				{Host: "host1", Address: "10.0.0.3", PortStates: []scan.PortState{port(22, open)}}},
+			expected: []scan.Change{
+				{Host: "host1", Address: "10.0.0.1", Kind: scan.PortClosed, Port: 22, Protocol: scan.TCP},
+				{Host: "host1", Address: "10.0.0.3", Kind: scan.HostAppeared},
+				{Host: "host1", Address: "10.0.0.3", Kind: scan.PortOpened, Port: 22, Protocol: scan.TCP},
+				{Host: "host1", Address: "10.0.0.2", Kind: scan.HostDisappeared},
+			}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := scan.Diff(tc.from, tc.to)
+			if !reflect.DeepEqual(changes, tc.expected) {
+				t.Errorf("expected changes %v, got %v instead\n", tc.expected, changes)
+			}
+		})
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	testCases := []struct {
+		change   scan.Change
+		expected string
+	}{
+		{change: scan.Change{Host: "host1", Kind: scan.HostAppeared}, expected: "+ host1: host appeared"},
+		{change: scan.Change{Host: "host1", Address: "10.0.0.2", Kind: scan.HostDisappeared},
+			expected: "- host1 (10.0.0.2): host disappeared"},
+		{change: scan.Change{Host: "host1", Kind: scan.PortOpened, Port: 22, Protocol: scan.TCP, Service: "ssh"},
+			expected: "+ host1: 22/tcp (ssh) opened"},
+		{change: scan.Change{Host: "host1", Kind: scan.PortClosed, Port: 53, Protocol: scan.UDP},
+			expected: "- host1: 53/udp closed"},
+		{change: scan.Change{Host: "host1", Kind: scan.PortChanged, Port: 23, Protocol: scan.TCP,
+			From: "closed", To: "filtered"}, expected: "~ host1: 23/tcp changed from closed to filtered"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if s := tc.change.String(); s != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultDiscoveryPorts are the ports of the TCP ping when none are set
+var DefaultDiscoveryPorts = []int{80, 443, 22, 445, 3389}
+
+type hostStatus int
+
+const (
+	// StatusUnknown is the status of the hosts when discovery is skipped
+	StatusUnknown hostStatus = iota
+	StatusUp
+	StatusDown
+)
+
+// String converts the value of hostStatus to a more human readable string
+func (s hostStatus) String() string {
+	switch s {
+	case StatusUp:
+		return "up"
+	case StatusDown:
+		return "down"
+	}
+	return "unknown"
+}
+
+func (s hostStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *hostStatus) UnmarshalText(text []byte) error {
+	for _, st := range []hostStatus{StatusUnknown, StatusUp, StatusDown} {
+		if st.String() == string(text) {
+			*s = st
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown host status %q", text)
+}
+
+// answers tells whether a host answers the TCP ping on port, that is whether
+// it accepts or refuses the connection within timeout
+func answers(ctx context.Context, host string, port int, timeout time.Duration) bool {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err == nil {
+		conn.Close()
+	}
+	return err == nil || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// discover pings the addresses with a limiter, one job per address and port,
+// ports first as for the port scan, the jobs sharing the workers and the rate
+// of the address. An address is up as soon as one of the ports answers, its
+// other jobs being skipped, and down when none of them answers.
+func discover(ctx context.Context, res []Results, limiters []*hostLimiter, ports []int,
+	concurrency int, timeout time.Duration) {
+	type job struct{ host, port int }
+	var jobs []job
+	for _, port := range ports {
+		for i := range res {
+			if limiters[i] != nil {
+				jobs = append(jobs, job{i, port})
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	up := make([]bool, len(res))
+	isUp := func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return up[i]
+	}
+
+	parallel(ctx, len(jobs), concurrency, func(j int) {
+		i := jobs[j].host
+		if isUp(i) {
+			return
+		}
+		limiters[i].wait(ctx)
+		if isUp(i) || !answers(ctx, res[i].Address, jobs[j].port, timeout) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		up[i] = true
+	})
+
+	for i := range res {
+		if limiters[i] == nil {
+			continue
+		}
+		res[i].Status = StatusDown
+		if up[i] {
+			res[i].Status = StatusUp
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package scan_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+func TestHostStatusString(t *testing.T) {
+	testCases := []struct {
+		status   scan.Results
+		expected string
+	}{
+		{scan.Results{}, "unknown"},
+		{scan.Results{Status: scan.StatusUp}, "up"},
+		{scan.Results{Status: scan.StatusDown}, "down"},
+	}
+
+	for _, tc := range testCases {
+		if tc.status.Status.String() != tc.expected {
+			t.Errorf("expected %q, got %q instead\n", tc.expected, tc.status.Status.String())
+		}
+	}
+}
+
+func TestRunDiscovery(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	openPort := ln.Addr().(*net.TCPAddr).Port
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	testCases := []struct {
+		name      string
+		opts      scan.Options
+		expStatus string
+		expPorts  int
+	}{
+		{name: "Skipped", opts: scan.Options{DiscoveryPorts: []int{closedPort}},
+			expStatus: "unknown", expPorts: 1},
+		{name: "UpAccepted", opts: scan.Options{Discovery: true, DiscoveryPorts: []int{closedPort, openPort}},
+			expStatus: "up", expPorts: 1},
+		{name: "UpRefused", opts: scan.Options{Discovery: true, DiscoveryPorts: []int{closedPort}},
+			expStatus: "up", expPorts: 1},
+		{name: "Down", opts: scan.Options{Discovery: true, DiscoveryPorts: []int{openPort}, Timeout: time.Nanosecond},
+			expStatus: "down", expPorts: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hl := &scan.HostsList{}
+			if err := hl.Add("127.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+
+			res := scan.Run(hl, []int{openPort}, tc.opts)
+			if len(res) != 1 || res[0].NotFound {
+				t.Fatalf("expected host to be found, got %+v instead\n", res)
+			}
+			if res[0].Status.String() != tc.expStatus {
+				t.Errorf("expected status %q, got %q instead\n", tc.expStatus, res[0].Status)
+			}
+			if len(res[0].Addresses) != 1 || res[0].Addresses[0] != "127.0.0.1" {
+				t.Errorf("expected address 127.0.0.1, got %v instead\n", res[0].Addresses)
+			}
+			if len(res[0].PortStates) != tc.expPorts {
+				t.Errorf("expected %d port states, got %d instead\n", tc.expPorts, len(res[0].PortStates))
+			}
+		})
+	}
+}
+
+func TestRunDiscoveryRate(t *testing.T) {
+	hl := &scan.HostsList{}
+	if err := hl.Add("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// none of the ports answers within the timeout, so that every one of
+	// them is pinged, at the rate of the host
+	opts := scan.Options{Discovery: true, DiscoveryPorts: []int{1, 2, 3, 4, 5},
+		Timeout: time.Nanosecond, HostRate: 20}
+	start := time.Now()
+	res := scan.Run(hl, []int{80}, opts)
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("expected the ping to take at least 180ms, took %s instead\n", elapsed)
+	}
+	if len(res) != 1 || res[0].Status != scan.StatusDown {
+		t.Errorf("expected host down, got %+v instead\n", res)
+	}
+}
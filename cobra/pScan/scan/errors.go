@@ -3,6 +3,13 @@ package scan
 import "errors"
 
 var (
-	ErrExists    = errors.New("Host already in the list")
-	ErrNotExists = errors.New("Host not in the list")
+	ErrExists          = errors.New("Host already in the list")
+	ErrNotExists       = errors.New("Host not in the list")
+	ErrInvalidPort     = errors.New("Invalid port")
+	ErrInvalidProtocol = errors.New("Invalid protocol")
+	ErrInvalidTarget   = errors.New("Invalid target")
+	ErrTooManyTargets  = errors.New("Too many targets")
+	ErrUnsupported     = errors.New("Not supported")
+	ErrScanNotExists   = errors.New("Scan not in the history")
+	ErrInvalidLabel    = errors.New("Invalid label")
 )
@@ -0,0 +1,145 @@
+package scan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// DefaultHistorySize is the number of scans the history keeps by default
+const DefaultHistorySize = 100
+
+var (
+	// historyLockTimeout is how long UpdateHistory waits for the lock of
+	// the history file, a lock older than that being left by a process that
+	// died holding it
+	historyLockTimeout = 10 * time.Second
+	historyLockRetry   = 10 * time.Millisecond
+)
+
+// Record is a scan kept in the history
+type Record struct {
+	ID       int       `json:"id"`
+	Time     time.Time `json:"time"`
+	Protocol string    `json:"protocol"`
+	Ports    []int     `json:"ports"`
+	Results  []Results `json:"results"`
+}
+
+// OpenPorts returns the number of open ports found by the scan
+func (r Record) OpenPorts() int {
+	n := 0
+	for _, res := range r.Results {
+		for _, ps := range res.PortStates {
+			if ps.State == StateOpen {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// History holds the past scans, oldest first
+type History struct {
+	Records []Record
+}
+
+// Add a scan to the history, numbering it after the last one
+func (h *History) Add(t time.Time, protocol string, ports []int, results []Results) Record {
+	id := 1
+	if len(h.Records) > 0 {
+		id = h.Records[len(h.Records)-1].ID + 1
+	}
+	if protocol == "" {
+		protocol = TCP
+	}
+	r := Record{ID: id, Time: t, Protocol: protocol, Ports: ports, Results: results}
+	h.Records = append(h.Records, r)
+	return r
+}
+
+// Trim drops the oldest scans, keeping the size most recent ones, or all of
+// them if size is not positive
+func (h *History) Trim(size int) {
+	if size > 0 && len(h.Records) > size {
+		h.Records = append([]Record{}, h.Records[len(h.Records)-size:]...)
+	}
+}
+
+// Get the scan with the given ID
+func (h *History) Get(id int) (Record, error) {
+	for _, r := range h.Records {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return Record{}, fmt.Errorf("%w: %d", ErrScanNotExists, id)
+}
+
+// Load the history from a history file
+func (h *History) Load(historyFile string) error {
+	file, err := ioutil.ReadFile(historyFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if len(file) == 0 {
+		return nil
+	}
+	return json.Unmarshal(file, &h.Records)
+}
+
+// Save the history to a history file
+func (h *History) Save(historyFile string) error {
+	js, err := json.Marshal(h.Records)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(historyFile, js, 0644)
+}
+
+// UpdateHistory loads the history file, applies update to it and saves it,
+// holding the lock file of the history so that the pScan processes sharing
+// the history file do not lose each other's scans
+func UpdateHistory(historyFile string, update func(h *History)) error {
+	unlock, err := lockHistory(historyFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	h := &History{}
+	if err := h.Load(historyFile); err != nil {
+		return err
+	}
+	update(h)
+	return h.Save(historyFile)
+}
+
+// lockHistory creates the lock file of the history file, waiting for the
+// process holding it, and returns the function releasing it
+func lockHistory(historyFile string) (func(), error) {
+	lock := historyFile + ".lock"
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		fi, err := os.Stat(lock)
+		if err == nil && time.Since(fi.ModTime()) > historyLockTimeout {
+			os.Remove(lock)
+			continue
+		}
+		time.Sleep(historyLockRetry)
+	}
+}
@@ -0,0 +1,166 @@
+package scan_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+func TestHistorySaveLoad(t *testing.T) {
+	h1 := &scan.History{}
+	h2 := &scan.History{}
+
+	start := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	results := []scan.Results{
+		{Host: "host1", PortStates: []scan.PortState{
+			{Port: 22, Protocol: scan.TCP, Service: "ssh", State: scan.StateOpen, Reason: "syn-ack"},
+		}},
+		{Host: "host2", NotFound: true},
+	}
+	r1 := h1.Add(start, "", []int{22}, results)
+	r2 := h1.Add(start.Add(time.Hour), scan.UDP, []int{53}, nil)
+	if r1.ID != 1 || r2.ID != 2 {
+		t.Fatalf("expected IDs 1 and 2, got %d and %d instead\n", r1.ID, r2.ID)
+	}
+	if r1.Protocol != scan.TCP {
+		t.Errorf("expected default protocol %q, got %q instead\n", scan.TCP, r1.Protocol)
+	}
+	if r1.OpenPorts() != 1 {
+		t.Errorf("expected 1 open port, got %d instead\n", r1.OpenPorts())
+	}
+
+	tf, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("error creating temp file: %s", err)
+	}
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	if err := h1.Save(tf.Name()); err != nil {
+		t.Fatalf("error saving history to file: %s", err)
+	}
+	if err := h2.Load(tf.Name()); err != nil {
+		t.Fatalf("error getting history from file: %s", err)
+	}
+	if !reflect.DeepEqual(h1.Records, h2.Records) {
+		t.Errorf("expected history %v, got %v instead\n", h1.Records, h2.Records)
+	}
+
+	if r3 := h2.Add(start, scan.TCP, nil, nil); r3.ID != 3 {
+		t.Errorf("expected ID 3 after loading, got %d instead\n", r3.ID)
+	}
+	got, err := h2.Get(2)
+	if err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+	if !got.Time.Equal(start.Add(time.Hour)) || got.Protocol != scan.UDP {
+		t.Errorf("expected scan 2, got %v instead\n", got)
+	}
+	if _, err := h2.Get(4); !errors.Is(err, scan.ErrScanNotExists) {
+		t.Errorf("expected error %q, got %q instead\n", scan.ErrScanNotExists, err)
+	}
+}
+
+func TestHistoryLoadNoFile(t *testing.T) {
+	tf, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("error creating temp file: %s", err)
+	}
+	tf.Close()
+	if err := os.Remove(tf.Name()); err != nil {
+		t.Fatalf("error deleting temp file: %s", err)
+	}
+
+	h := &scan.History{}
+	if err := h.Load(tf.Name()); err != nil {
+		t.Errorf("expected no error, got %q instead\n", err)
+	}
+}
+
+func TestHistoryTrim(t *testing.T) {
+	testCases := []struct {
+		name   string
+		size   int
+		expIDs []int
+	}{
+		{name: "Unlimited", size: 0, expIDs: []int{1, 2, 3}},
+		{name: "Larger", size: 5, expIDs: []int{1, 2, 3}},
+		{name: "Trimmed", size: 2, expIDs: []int{2, 3}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &scan.History{}
+			for i := 0; i < 3; i++ {
+				h.Add(time.Now(), scan.TCP, []int{22}, nil)
+			}
+
+			h.Trim(tc.size)
+			ids := []int{}
+			for _, r := range h.Records {
+				ids = append(ids, r.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.expIDs) {
+				t.Errorf("expected scans %v, got %v instead\n", tc.expIDs, ids)
+			}
+		})
+	}
+}
+
+func TestUpdateHistory(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "pScan.history")
+	start := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := scan.UpdateHistory(historyFile, func(h *scan.History) {
+					h.Add(start, scan.TCP, []int{22}, nil)
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		h := &scan.History{}
+		if err := h.Load(historyFile); err != nil {
+			t.Fatal(err)
+		}
+		if len(h.Records) != 10 {
+			t.Errorf("expected 10 records, got %d instead\n", len(h.Records))
+		}
+		if _, err := os.Stat(historyFile + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("expected lock file removed, got %v instead\n", err)
+		}
+	})
+
+	t.Run("StaleLock", func(t *testing.T) {
+		lock := historyFile + ".lock"
+		if err := os.WriteFile(lock, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(lock, old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		err := scan.UpdateHistory(historyFile, func(h *scan.History) {
+			h.Add(start, scan.TCP, []int{22}, nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -2,34 +2,136 @@ package scan
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
+// Host is an entry of the hosts list with its metadata
+type Host struct {
+	Name string `json:"name" yaml:"name"`
+	// Groups the host belongs to, such as web or db
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	// Labels are free key value pairs, such as env=prod
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Ports are the port specifications scanned on the host instead of the
+	// ports of the scan
+	Ports   []string `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Comment string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// validate checks the entry and port specifications of the host
+func (h Host) validate() error {
+	if err := ValidateTarget(h.Name); err != nil {
+		return err
+	}
+	_, err := ParsePorts(h.Ports, nil)
+	return err
+}
+
+// scanPorts returns the ports to scan on the host, defaults unless the host
+// overrides them
+func (h Host) scanPorts(defaults []int) []int {
+	if len(h.Ports) == 0 {
+		return defaults
+	}
+	ports, err := ParsePorts(h.Ports, nil)
+	if err != nil {
+		return defaults
+	}
+	return ports
+}
+
+// Selector picks hosts by group and label. A host matches when it belongs to
+// any of the groups and has all the labels; an empty selector matches all.
+type Selector struct {
+	Groups []string
+	Labels map[string]string
+}
+
+// Match reports whether the host matches the selector
+func (s Selector) Match(h Host) bool {
+	if len(s.Groups) > 0 {
+		member := false
+		for _, g := range s.Groups {
+			for _, hg := range h.Groups {
+				if g == hg {
+					member = true
+				}
+			}
+		}
+		if !member {
+			return false
+		}
+	}
+	for k, v := range s.Labels {
+		if hv, ok := h.Labels[k]; !ok || hv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabels converts key=value label specifications to a map
+func ParseLabels(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		k, v, ok := strings.Cut(spec, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%w: %q is not key=value", ErrInvalidLabel, spec)
+		}
+		labels[k] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
+
 type HostsList struct {
-	Hosts []string
+	Hosts []Host
+}
+
+// hostsDocument is the structure of the YAML and JSON hosts files
+type hostsDocument struct {
+	Hosts []Host `json:"hosts" yaml:"hosts"`
 }
 
 // Search for a host in the hosts list
 func (hl *HostsList) search(host string) (bool, int) {
-	sort.Strings(hl.Hosts)
+	sort.Slice(hl.Hosts, func(i, j int) bool { return hl.Hosts[i].Name < hl.Hosts[j].Name })
 
-	i := sort.SearchStrings(hl.Hosts, host)
-	if i < len(hl.Hosts) && hl.Hosts[i] == host {
+	i := sort.Search(len(hl.Hosts), func(i int) bool { return hl.Hosts[i].Name >= host })
+	if i < len(hl.Hosts) && hl.Hosts[i].Name == host {
 		return true, i
 	}
 	return false, -1
 }
 
-// Add a host to the hosts list
+// Add a host to the hosts list. Besides host names and addresses, the list
+// accepts CIDR blocks, address ranges and @files of targets.
 func (hl *HostsList) Add(host string) error {
-	if found, _ := hl.search(host); found {
-		return fmt.Errorf("%w: %s", ErrExists, host)
+	return hl.AddHost(Host{Name: host})
+}
+
+// AddHost adds a host with its metadata to the hosts list
+func (hl *HostsList) AddHost(h Host) error {
+	if err := h.validate(); err != nil {
+		return err
+	}
+	if found, _ := hl.search(h.Name); found {
+		return fmt.Errorf("%w: %s", ErrExists, h.Name)
 	}
-	hl.Hosts = append(hl.Hosts, host)
+	hl.Hosts = append(hl.Hosts, h)
 	return nil
 }
 
@@ -42,30 +144,104 @@ func (hl *HostsList) Remove(host string) error {
 	return fmt.Errorf("%w: %s", ErrNotExists, host)
 }
 
-// Load hosts from a hosts file
+// Select returns the list of the hosts matching the selector
+func (hl *HostsList) Select(s Selector) *HostsList {
+	selected := &HostsList{}
+	for _, h := range hl.Hosts {
+		if s.Match(h) {
+			selected.Hosts = append(selected.Hosts, h)
+		}
+	}
+	return selected
+}
+
+// Load hosts from a hosts file, either structured in YAML or JSON, or in the
+// legacy format of one host per line. Legacy files are migrated to the
+// structured format the next time the list is saved.
 func (hl *HostsList) Load(hostsFile string) error {
-	f, err := os.Open(hostsFile)
+	content, err := ioutil.ReadFile(hostsFile)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil
 		}
 		return err
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		hl.Hosts = append(hl.Hosts, scanner.Text())
+	var hosts []Host
+	if isStructured(content) {
+		var hf hostsDocument
+		if err := yaml.Unmarshal(content, &hf); err != nil {
+			return fmt.Errorf("%s: %w", hostsFile, err)
+		}
+		hosts = hf.Hosts
+	} else {
+		hosts = parseLegacy(content)
+	}
+
+	// the entries themselves are checked at scan time, as the files of
+	// targets they refer to may come and go
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if h.Name == "" || seen[h.Name] {
+			continue
+		}
+		if _, err := ParsePorts(h.Ports, nil); err != nil {
+			return fmt.Errorf("%s: host %s: %w", hostsFile, h.Name, err)
+		}
+		seen[h.Name] = true
+		hl.Hosts = append(hl.Hosts, h)
 	}
 	return nil
 }
 
-// Save hosts to a hosts file
+// isStructured reports whether the content of a hosts file is a YAML or JSON
+// document, rather than the legacy list of hosts
+func isStructured(content []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return strings.HasPrefix(line, "{") || strings.HasPrefix(line, "hosts:")
+	}
+	return false
+}
+
+// parseLegacy reads the hosts of the legacy format, skipping blank lines and
+// # comments
+func parseLegacy(content []byte) []Host {
+	hosts := []Host{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, Host{Name: line})
+	}
+	return hosts
+}
+
+// Save hosts to a hosts file, in JSON if its name has the .json extension and
+// in YAML otherwise
 func (hl *HostsList) Save(hostsFile string) error {
-	output := ""
-	for _, h := range hl.Hosts {
-		output += fmt.Sprintln(h)
+	hf := hostsDocument{Hosts: hl.Hosts}
+	if hf.Hosts == nil {
+		hf.Hosts = []Host{}
+	}
+
+	var output []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(hostsFile), ".json") {
+		output, err = json.MarshalIndent(hf, "", "  ")
+		output = append(output, '\n')
+	} else {
+		output, err = yaml.Marshal(hf)
+	}
+	if err != nil {
+		return err
 	}
 
-	return ioutil.WriteFile(hostsFile, []byte(output), 0644)
+	return ioutil.WriteFile(hostsFile, output, 0644)
 }
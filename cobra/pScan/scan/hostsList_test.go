@@ -4,6 +4,9 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/boeboe/learngo/cobra/pScan/scan"
@@ -18,6 +21,10 @@ func TestAdd(t *testing.T) {
 	}{
 		{name: "AddNew", host: "host2", expLen: 2, expErr: nil},
 		{name: "AddExisting", host: "host1", expLen: 1, expErr: scan.ErrExists},
+		{name: "AddCIDR", host: "10.0.0.0/28", expLen: 2, expErr: nil},
+		{name: "AddRange", host: "10.0.0.1-20", expLen: 2, expErr: nil},
+		{name: "AddInvalidCIDR", host: "10.0.0.0/40", expLen: 1, expErr: scan.ErrInvalidTarget},
+		{name: "AddInvalidRange", host: "10.0.0.20-1", expLen: 1, expErr: scan.ErrInvalidTarget},
 	}
 
 	for _, tc := range testCases {
@@ -45,8 +52,8 @@ func TestAdd(t *testing.T) {
 			if len(hl.Hosts) != tc.expLen {
 				t.Errorf("expected hosts list length %d, got % d instead\n", tc.expLen, len(hl.Hosts))
 			}
-			if hl.Hosts[1] != tc.host {
-				t.Errorf("expected host name %q as index 1, got %q instead\n", tc.host, hl.Hosts[1])
+			if hl.Hosts[1].Name != tc.host {
+				t.Errorf("expected host name %q as index 1, got %q instead\n", tc.host, hl.Hosts[1].Name)
 			}
 		})
 	}
@@ -90,7 +97,7 @@ func TestRemove(t *testing.T) {
 			if len(hl.Hosts) != tc.expLen {
 				t.Errorf("expected hosts list length %d, got % d instead\n", tc.expLen, len(hl.Hosts))
 			}
-			if hl.Hosts[0] == tc.host {
+			if hl.Hosts[0].Name == tc.host {
 				t.Errorf("host name %q should not be in the list\n", tc.host)
 			}
 		})
@@ -117,8 +124,8 @@ func TestSaveLoad(t *testing.T) {
 		t.Fatalf("error loading list from file: %s\n", err)
 	}
 
-	if hl1.Hosts[0] != hl2.Hosts[0] {
-		t.Fatalf("saved host %q should match loaded host %q\n", hl1.Hosts[0], hl2.Hosts[0])
+	if hl1.Hosts[0].Name != hl2.Hosts[0].Name {
+		t.Fatalf("saved host %q should match loaded host %q\n", hl1.Hosts[0].Name, hl2.Hosts[0].Name)
 	}
 }
 
@@ -136,3 +143,176 @@ func TestLoadNoFile(t *testing.T) {
 		t.Errorf("expected no error, got %q instead\n", err)
 	}
 }
+
+func TestLoadFormats(t *testing.T) {
+	expHosts := []scan.Host{
+		{Name: "host1", Groups: []string{"web"}, Labels: map[string]string{"env": "prod"},
+			Ports: []string{"22", "web"}, Comment: "front end"},
+		{Name: "10.0.0.0/28", Groups: []string{"db"}},
+	}
+
+	testCases := []struct {
+		name     string
+		content  string
+		expHosts []scan.Host
+		expErr   bool
+	}{
+		{name: "Legacy", content: "# legacy\nhost1\n\n10.0.0.0/28\nhost1\n",
+			expHosts: []scan.Host{{Name: "host1"}, {Name: "10.0.0.0/28"}}},
+		{name: "YAML", content: `# our hosts
+hosts:
+  - name: host1
+    groups: [web]
+    labels: {env: prod}
+    ports: ["22", web]
+    comment: front end
+  - name: 10.0.0.0/28 # the databases
+    groups: [db]
+  - name: host1
+`, expHosts: expHosts},
+		{name: "JSON", content: `{"hosts": [
+  {"name": "host1", "groups": ["web"], "labels": {"env": "prod"}, "ports": ["22", "web"], "comment": "front end"},
+  {"name": "10.0.0.0/28", "groups": ["db"]}
+]}`, expHosts: expHosts},
+		{name: "InvalidPorts", content: "hosts:\n  - name: host1\n    ports: [\"0\"]\n", expErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tf, err := ioutil.TempFile("", "hostList")
+			if err != nil {
+				t.Fatalf("error creating temp file: %s\n", err)
+			}
+			defer os.Remove(tf.Name())
+			if _, err := tf.WriteString(tc.content); err != nil {
+				t.Fatal(err)
+			}
+			tf.Close()
+
+			hl := &scan.HostsList{}
+			err = hl.Load(tf.Name())
+			if tc.expErr {
+				if !errors.Is(err, scan.ErrInvalidPort) {
+					t.Errorf("expected error %q, got %q instead\n", scan.ErrInvalidPort, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %q instead\n", err)
+			}
+			if !reflect.DeepEqual(hl.Hosts, tc.expHosts) {
+				t.Errorf("expected hosts %+v, got %+v instead\n", tc.expHosts, hl.Hosts)
+			}
+		})
+	}
+}
+
+func TestSaveMigrates(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"pScan.hosts", "pScan.json"} {
+		t.Run(name, func(t *testing.T) {
+			hostsFile := filepath.Join(dir, name)
+			if err := os.WriteFile(hostsFile, []byte("host1\nhost2\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			hl1 := &scan.HostsList{}
+			if err := hl1.Load(hostsFile); err != nil {
+				t.Fatal(err)
+			}
+			hl1.Hosts[0].Groups = []string{"web"}
+			if err := hl1.Save(hostsFile); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(hostsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix := "hosts:"
+			if filepath.Ext(name) == ".json" {
+				prefix = "{"
+			}
+			if !strings.HasPrefix(string(content), prefix) {
+				t.Errorf("expected structured file starting with %q, got %q instead\n", prefix, content)
+			}
+
+			hl2 := &scan.HostsList{}
+			if err := hl2.Load(hostsFile); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(hl1.Hosts, hl2.Hosts) {
+				t.Errorf("expected hosts %+v, got %+v instead\n", hl1.Hosts, hl2.Hosts)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	hl := &scan.HostsList{Hosts: []scan.Host{
+		{Name: "web1", Groups: []string{"web"}, Labels: map[string]string{"env": "prod"}},
+		{Name: "web2", Groups: []string{"web"}, Labels: map[string]string{"env": "test"}},
+		{Name: "db1", Groups: []string{"db"}, Labels: map[string]string{"env": "prod"}},
+		{Name: "other"},
+	}}
+
+	testCases := []struct {
+		name     string
+		selector scan.Selector
+		expHosts []string
+	}{
+		{name: "All", selector: scan.Selector{}, expHosts: []string{"web1", "web2", "db1", "other"}},
+		{name: "Group", selector: scan.Selector{Groups: []string{"web"}}, expHosts: []string{"web1", "web2"}},
+		{name: "AnyGroup", selector: scan.Selector{Groups: []string{"web", "db"}}, expHosts: []string{"web1", "web2", "db1"}},
+		{name: "Label", selector: scan.Selector{Labels: map[string]string{"env": "prod"}}, expHosts: []string{"web1", "db1"}},
+		{name: "GroupAndLabel", selector: scan.Selector{Groups: []string{"web"}, Labels: map[string]string{"env": "prod"}},
+			expHosts: []string{"web1"}},
+		{name: "NoMatch", selector: scan.Selector{Groups: []string{"mail"}}, expHosts: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var hosts []string
+			for _, h := range hl.Select(tc.selector).Hosts {
+				hosts = append(hosts, h.Name)
+			}
+			if !reflect.DeepEqual(hosts, tc.expHosts) {
+				t.Errorf("expected hosts %v, got %v instead\n", tc.expHosts, hosts)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	testCases := []struct {
+		name      string
+		specs     []string
+		expLabels map[string]string
+		expErr    error
+	}{
+		{name: "None", specs: nil, expLabels: nil},
+		{name: "Labels", specs: []string{"env=prod", "team = ops", "empty="},
+			expLabels: map[string]string{"env": "prod", "team": "ops", "empty": ""}},
+		{name: "NoValue", specs: []string{"env"}, expErr: scan.ErrInvalidLabel},
+		{name: "NoKey", specs: []string{"=prod"}, expErr: scan.ErrInvalidLabel},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			labels, err := scan.ParseLabels(tc.specs)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Errorf("expected error %q, got %q instead\n", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %q instead\n", err)
+			}
+			if !reflect.DeepEqual(labels, tc.expLabels) {
+				t.Errorf("expected labels %v, got %v instead\n", tc.expLabels, labels)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package scan
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultInterval is the time between two scans of a monitor
+const DefaultInterval = 5 * time.Minute
+
+// Alert is a change between two scans of a monitor
+type Alert struct {
+	Time time.Time `json:"time"`
+	Change
+}
+
+// Monitor scans the hosts at regular intervals, sending the changes from one
+// scan to the next to its sinks
+type Monitor struct {
+	// Interval is the time between the start of two scans, DefaultInterval
+	// if not positive
+	Interval time.Duration
+	// Scan runs a scan of the hosts, stopping when ctx is done
+	Scan func(ctx context.Context) ([]Results, error)
+	// Sinks receive the alerts of every scan with changes
+	Sinks []Sink
+	// OnError is called with the errors of the scans and the sinks, which do
+	// not stop the monitor
+	OnError func(error)
+}
+
+// Run scans the hosts until ctx is done, the first scan being the baseline
+// the next ones are compared to. A failed scan is skipped, the next one being
+// compared to the last successful scan. The scan in progress when ctx is done
+// is dropped.
+func (m *Monitor) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []Results
+	baseline := false
+	for {
+		results, err := m.Scan(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			m.error(err)
+		case !baseline:
+			last, baseline = results, true
+		default:
+			m.notify(Diff(last, results))
+			last = results
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (m *Monitor) notify(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	now := time.Now()
+	alerts := make([]Alert, len(changes))
+	for i, c := range changes {
+		alerts[i] = Alert{Time: now, Change: c}
+	}
+	for _, s := range m.Sinks {
+		if err := s.Notify(alerts); err != nil {
+			m.error(err)
+		}
+	}
+}
+
+func (m *Monitor) error(err error) {
+	if m.OnError != nil {
+		m.OnError(err)
+	}
+}
@@ -0,0 +1,89 @@
+package scan_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+// recordSink keeps the alerts it receives
+type recordSink struct {
+	alerts [][]scan.Alert
+	err    error
+}
+
+func (s *recordSink) Notify(alerts []scan.Alert) error {
+	s.alerts = append(s.alerts, alerts)
+	return s.err
+}
+
+func TestMonitor(t *testing.T) {
+	open := []scan.Results{{Host: "host1", PortStates: []scan.PortState{
+		{Port: 22, Protocol: scan.TCP, State: scan.StateOpen}}}}
+	closed := []scan.Results{{Host: "host1", PortStates: []scan.PortState{
+		{Port: 22, Protocol: scan.TCP, State: scan.StateClosed}}}}
+	errScan := errors.New("scan failed")
+
+	// the second scan fails, the third one is compared to the first
+	scans := []struct {
+		results []scan.Results
+		err     error
+	}{{open, nil}, {nil, errScan}, {closed, nil}, {closed, nil}, {open, nil}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := 0
+	sink := &recordSink{}
+	failing := &recordSink{err: errors.New("sink failed")}
+	var errs []error
+	m := &scan.Monitor{
+		Interval: time.Millisecond,
+		Sinks:    []scan.Sink{sink, failing},
+		Scan: func(ctx context.Context) ([]scan.Results, error) {
+			// stop in the middle of the scan after the last one
+			if n == len(scans) {
+				cancel()
+				return nil, ctx.Err()
+			}
+			s := scans[n]
+			n++
+			return s.results, s.err
+		},
+		OnError: func(err error) { errs = append(errs, err) },
+	}
+
+	if err := m.Run(ctx); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+	if n != len(scans) {
+		t.Fatalf("expected %d scans, got %d instead\n", len(scans), n)
+	}
+
+	expChanges := [][]scan.Change{
+		{{Host: "host1", Kind: scan.PortClosed, Port: 22, Protocol: scan.TCP}},
+		{{Host: "host1", Kind: scan.PortOpened, Port: 22, Protocol: scan.TCP}},
+	}
+	var changes [][]scan.Change
+	for _, alerts := range sink.alerts {
+		var c []scan.Change
+		for _, a := range alerts {
+			if a.Time.IsZero() {
+				t.Errorf("expected alert time to be set")
+			}
+			c = append(c, a.Change)
+		}
+		changes = append(changes, c)
+	}
+	if !reflect.DeepEqual(changes, expChanges) {
+		t.Errorf("expected alerts %v, got %v instead\n", expChanges, changes)
+	}
+
+	if len(errs) != 3 || !errors.Is(errs[0], errScan) {
+		t.Errorf("expected the scan error and 2 sink errors, got %v instead\n", errs)
+	}
+}
@@ -0,0 +1,218 @@
+package scan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MinPort = 1
+	MaxPort = 65535
+)
+
+// services maps the well known TCP ports to the name of their service
+var services = map[int]string{
+	20:    "ftp-data",
+	21:    "ftp",
+	22:    "ssh",
+	23:    "telnet",
+	25:    "smtp",
+	53:    "domain",
+	80:    "http",
+	110:   "pop3",
+	111:   "rpcbind",
+	135:   "msrpc",
+	139:   "netbios-ssn",
+	143:   "imap",
+	389:   "ldap",
+	443:   "https",
+	445:   "microsoft-ds",
+	465:   "smtps",
+	587:   "submission",
+	636:   "ldaps",
+	993:   "imaps",
+	995:   "pop3s",
+	1433:  "ms-sql-s",
+	1521:  "oracle",
+	1723:  "pptp",
+	2049:  "nfs",
+	2375:  "docker",
+	2376:  "docker-s",
+	3000:  "ppp",
+	3306:  "mysql",
+	3389:  "ms-wbt-server",
+	5000:  "upnp",
+	5432:  "postgresql",
+	5672:  "amqp",
+	5900:  "vnc",
+	5984:  "couchdb",
+	6379:  "redis",
+	6443:  "kubernetes",
+	8000:  "http-alt",
+	8080:  "http-proxy",
+	8443:  "https-alt",
+	8888:  "sun-answerbook",
+	9000:  "cslistener",
+	9042:  "cassandra",
+	9200:  "elasticsearch",
+	11211: "memcache",
+	27017: "mongodb",
+}
+
+// udpServices maps the well known UDP ports to the name of their service
+var udpServices = map[int]string{
+	53:   "domain",
+	67:   "dhcps",
+	68:   "dhcpc",
+	69:   "tftp",
+	123:  "ntp",
+	137:  "netbios-ns",
+	138:  "netbios-dgm",
+	161:  "snmp",
+	162:  "snmptrap",
+	500:  "isakmp",
+	514:  "syslog",
+	520:  "route",
+	1900: "upnp",
+	4500: "nat-t-ike",
+	5353: "mdns",
+}
+
+// topPorts are the ports of services most often found open, in decreasing
+// order of frequency
+var topPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139,
+	143, 53, 135, 3306, 8080, 1723, 111, 995, 993, 5900,
+	587, 8888, 199, 1720, 465, 548, 113, 81, 6001, 10000,
+	514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554, 26,
+	1433, 49152, 2001, 515, 8008, 49154, 1027, 5666, 646, 5000,
+	5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106, 2121,
+	1110, 49155, 6000, 513, 990, 5357, 427, 49156, 543, 544,
+	5101, 144, 7, 389, 8009, 3128, 444, 9999, 5009, 7070,
+	5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051, 6646,
+	49157, 1028, 873, 1755, 2717, 4899, 9100, 119, 37, 6379,
+}
+
+// portGroups are the named sets of ports accepted in port specifications
+var portGroups = map[string][]int{
+	"web":  {80, 443, 8000, 8080, 8443},
+	"db":   {1433, 1521, 3306, 5432, 5984, 6379, 9042, 9200, 11211, 27017},
+	"mail": {25, 110, 143, 465, 587, 993, 995},
+}
+
+// ServiceName returns the name of the service usually listening on port with
+// protocol, or an empty string if unknown
+func ServiceName(protocol string, port int) string {
+	if protocol == UDP {
+		return udpServices[port]
+	}
+	return services[port]
+}
+
+// MaxTopPorts is the number of ports TopPorts knows of
+var MaxTopPorts = len(topPorts)
+
+// CheckTopPorts rejects a number of top ports TopPorts cannot return
+func CheckTopPorts(n int) error {
+	if n < 0 || n > MaxTopPorts {
+		return fmt.Errorf("%w: %d top ports, at most %d are known", ErrInvalidPort, n, MaxTopPorts)
+	}
+	return nil
+}
+
+// TopPorts returns the n ports most often found open, at most MaxTopPorts
+func TopPorts(n int) []int {
+	if n > len(topPorts) {
+		n = len(topPorts)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return append([]int{}, topPorts[:n]...)
+}
+
+// PortGroups returns the names of the port groups in alphabetical order
+func PortGroups() []string {
+	names := make([]string, 0, len(portGroups))
+	for name := range portGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parsePort converts a port number, checking it is in the valid range
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(s)
+	if err != nil || p < MinPort || p > MaxPort {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPort, s)
+	}
+	return p, nil
+}
+
+// expandPortSpec returns the ports of a single specification: a port number,
+// an inclusive range such as 1-1024 or the name of a port group
+func expandPortSpec(spec string) ([]int, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if group, ok := portGroups[spec]; ok {
+		return group, nil
+	}
+
+	if from, to, ok := strings.Cut(spec, "-"); ok {
+		start, err := parsePort(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parsePort(to)
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, fmt.Errorf("%w: empty range %q", ErrInvalidPort, spec)
+		}
+
+		ports := make([]int, 0, end-start+1)
+		for p := start; p <= end; p++ {
+			ports = append(ports, p)
+		}
+		return ports, nil
+	}
+
+	p, err := parsePort(spec)
+	if err != nil {
+		return nil, err
+	}
+	return []int{p}, nil
+}
+
+// ParsePorts expands the port specifications, leaving out the excluded ones.
+// The ports keep the order of the specifications, without duplicates.
+func ParsePorts(specs, exclude []string) ([]int, error) {
+	skip := make(map[int]bool)
+	for _, spec := range exclude {
+		ports, err := expandPortSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ports {
+			skip[p] = true
+		}
+	}
+
+	ports := []int{}
+	for _, spec := range specs {
+		expanded, err := expandPortSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range expanded {
+			if !skip[p] {
+				ports = append(ports, p)
+				skip[p] = true
+			}
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,122 @@
+package scan_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+func TestParsePorts(t *testing.T) {
+	testCases := []struct {
+		name     string
+		specs    []string
+		exclude  []string
+		expPorts []int
+		expErr   error
+	}{
+		{name: "Single", specs: []string{"22", "80"}, expPorts: []int{22, 80}},
+		{name: "Range", specs: []string{"20-25"}, expPorts: []int{20, 21, 22, 23, 24, 25}},
+		{name: "Group", specs: []string{"mail"}, expPorts: []int{25, 110, 143, 465, 587, 993, 995}},
+		{name: "GroupCase", specs: []string{" Web "}, expPorts: []int{80, 443, 8000, 8080, 8443}},
+		{name: "Duplicates", specs: []string{"80", "web", "79-81"}, expPorts: []int{80, 443, 8000, 8080, 8443, 79, 81}},
+		{name: "Exclude", specs: []string{"20-25"}, exclude: []string{"21", "23-24"}, expPorts: []int{20, 22, 25}},
+		{name: "ExcludeGroup", specs: []string{"1-100"}, exclude: []string{"2-100", "web"}, expPorts: []int{1}},
+		{name: "Empty", specs: []string{}, expPorts: []int{}},
+		{name: "InvalidNumber", specs: []string{"http"}, expErr: scan.ErrInvalidPort},
+		{name: "OutOfRange", specs: []string{"0-10"}, expErr: scan.ErrInvalidPort},
+		{name: "TooHigh", specs: []string{"65536"}, expErr: scan.ErrInvalidPort},
+		{name: "ReversedRange", specs: []string{"25-20"}, expErr: scan.ErrInvalidPort},
+		{name: "InvalidExclude", specs: []string{"22"}, exclude: []string{"x"}, expErr: scan.ErrInvalidPort},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ports, err := scan.ParsePorts(tc.specs, tc.exclude)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("expected error %q, got %q instead", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %q instead", err)
+			}
+			if !reflect.DeepEqual(ports, tc.expPorts) {
+				t.Errorf("expected ports %v, got %v instead", tc.expPorts, ports)
+			}
+		})
+	}
+}
+
+func TestTopPorts(t *testing.T) {
+	testCases := []struct {
+		n      int
+		expLen int
+	}{
+		{n: 0, expLen: 0},
+		{n: 5, expLen: 5},
+		{n: 100, expLen: 100},
+		{n: 5000, expLen: 100},
+	}
+
+	for _, tc := range testCases {
+		ports := scan.TopPorts(tc.n)
+		if len(ports) != tc.expLen {
+			t.Errorf("expected %d top ports, got %d instead", tc.expLen, len(ports))
+		}
+
+		seen := map[int]bool{}
+		for _, p := range ports {
+			if seen[p] {
+				t.Errorf("duplicate top port %d", p)
+			}
+			seen[p] = true
+		}
+	}
+
+	if ports := scan.TopPorts(3); !reflect.DeepEqual(ports, []int{80, 23, 443}) {
+		t.Errorf("expected the most common ports first, got %v instead", ports)
+	}
+}
+
+func TestCheckTopPorts(t *testing.T) {
+	testCases := []struct {
+		n      int
+		expErr error
+	}{
+		{n: 0},
+		{n: scan.MaxTopPorts},
+		{n: scan.MaxTopPorts + 1, expErr: scan.ErrInvalidPort},
+		{n: -1, expErr: scan.ErrInvalidPort},
+	}
+
+	for _, tc := range testCases {
+		if err := scan.CheckTopPorts(tc.n); !errors.Is(err, tc.expErr) {
+			t.Errorf("expected error %v for %d top ports, got %v instead", tc.expErr, tc.n, err)
+		}
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	testCases := []struct {
+		protocol   string
+		port       int
+		expService string
+	}{
+		{protocol: scan.TCP, port: 22, expService: "ssh"},
+		{protocol: scan.TCP, port: 443, expService: "https"},
+		{protocol: scan.TCP, port: 5432, expService: "postgresql"},
+		{protocol: scan.TCP, port: 54321, expService: ""},
+		{protocol: scan.UDP, port: 53, expService: "domain"},
+		{protocol: scan.UDP, port: 161, expService: "snmp"},
+		{protocol: scan.UDP, port: 22, expService: ""},
+	}
+
+	for _, tc := range testCases {
+		if s := scan.ServiceName(tc.protocol, tc.port); s != tc.expService {
+			t.Errorf("expected service %q for port %d/%s, got %q instead", tc.expService, tc.port, tc.protocol, s)
+		}
+	}
+}
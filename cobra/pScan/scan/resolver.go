@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Resolver looks up the addresses of the hosts and the names of the
+// addresses. net.DefaultResolver is the Resolver of the scans when none is
+// set.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// StaticResolver resolves the hosts and addresses from fixed tables instead
+// of the DNS, so that scans can be run offline
+type StaticResolver struct {
+	// Hosts are the addresses of the host names
+	Hosts map[string][]string
+	// Names are the PTR names of the addresses
+	Names map[string][]string
+}
+
+// LookupHost returns the addresses of host, or host itself if it is an
+// address as net.Resolver does
+func (r StaticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return []string{host}, nil
+	}
+	addrs, ok := r.Hosts[host]
+	if !ok || len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return append([]string{}, addrs...), nil
+}
+
+// LookupAddr returns the names of addr
+func (r StaticResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	names, ok := r.Names[addr]
+	if !ok || len(names) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return append([]string{}, names...), nil
+}
+
+// reverseNames returns the PTR names of addr without their trailing dot, or
+// nil if it has none
+func reverseNames(ctx context.Context, r Resolver, addr string) []string {
+	names, err := r.LookupAddr(ctx, addr)
+	if err != nil {
+		return nil
+	}
+	var trimmed []string
+	for _, name := range names {
+		trimmed = append(trimmed, strings.TrimSuffix(name, "."))
+	}
+	return trimmed
+}
@@ -0,0 +1,118 @@
+package scan_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+func TestRunResolver(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// 127.0.0.2 is a loopback address nothing listens on
+	resolver := scan.StaticResolver{
+		Hosts: map[string][]string{
+			"web":   {"127.0.0.1"},
+			"multi": {"127.0.0.2", "127.0.0.1"},
+			"dual":  {"2001:db8::1", "127.0.0.1"},
+		},
+		Names: map[string][]string{
+			"127.0.0.1": {"web.example.com.", "www.example.com."},
+		},
+	}
+
+	type target struct {
+		address string
+		names   []string
+		state   string
+	}
+	testCases := []struct {
+		name         string
+		host         string
+		allAddresses bool
+		reverseDNS   bool
+		expAddresses []string
+		expTargets   []target
+	}{
+		{name: "SingleAddress", host: "web", expAddresses: []string{"127.0.0.1"},
+			expTargets: []target{{address: "127.0.0.1", state: "open"}}},
+		{name: "FirstAddress", host: "multi", expAddresses: []string{"127.0.0.2", "127.0.0.1"},
+			expTargets: []target{{address: "127.0.0.2", state: "closed"}}},
+		{name: "AllAddresses", host: "multi", allAddresses: true, expAddresses: []string{"127.0.0.2", "127.0.0.1"},
+			expTargets: []target{{address: "127.0.0.2", state: "closed"}, {address: "127.0.0.1", state: "open"}}},
+		{name: "IPv4First", host: "dual", expAddresses: []string{"127.0.0.1", "2001:db8::1"},
+			expTargets: []target{{address: "127.0.0.1", state: "open"}}},
+		{name: "ReverseDNS", host: "web", reverseDNS: true, expAddresses: []string{"127.0.0.1"},
+			expTargets: []target{{address: "127.0.0.1", names: []string{"web.example.com", "www.example.com"}, state: "open"}}},
+		{name: "ReverseDNSAddress", host: "127.0.0.2", reverseDNS: true, expAddresses: []string{"127.0.0.2"},
+			expTargets: []target{{address: "127.0.0.2", state: "closed"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hl := &scan.HostsList{}
+			hl.Add(tc.host)
+
+			res := scan.Run(hl, []int{port}, scan.Options{Resolver: resolver,
+				AllAddresses: tc.allAddresses, ReverseDNS: tc.reverseDNS})
+			if len(res) != len(tc.expTargets) {
+				t.Fatalf("expected %d results, got %d instead\n", len(tc.expTargets), len(res))
+			}
+
+			for i, exp := range tc.expTargets {
+				r := res[i]
+				if r.Host != tc.host || r.NotFound {
+					t.Errorf("expected host %q found, got %+v instead\n", tc.host, r)
+				}
+				if !reflect.DeepEqual(r.Addresses, tc.expAddresses) {
+					t.Errorf("expected addresses %v, got %v instead\n", tc.expAddresses, r.Addresses)
+				}
+				if r.Address != exp.address {
+					t.Errorf("expected address %q scanned, got %q instead\n", exp.address, r.Address)
+				}
+				if !reflect.DeepEqual(r.Names, exp.names) {
+					t.Errorf("expected names %v, got %v instead\n", exp.names, r.Names)
+				}
+				if len(r.PortStates) != 1 || r.PortStates[0].State.String() != exp.state {
+					t.Errorf("expected port %s, got %+v instead\n", exp.state, r.PortStates)
+				}
+			}
+		})
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		hl := &scan.HostsList{}
+		hl.Add("unknown")
+
+		res := scan.Run(hl, []int{port}, scan.Options{Resolver: resolver})
+		if len(res) != 1 || !res[0].NotFound || res[0].Address != "" {
+			t.Errorf("expected host not found, got %+v instead\n", res)
+		}
+	})
+}
+
+func TestRunAllAddressesRate(t *testing.T) {
+	resolver := scan.StaticResolver{
+		Hosts: map[string][]string{"multi": {"127.0.0.1", "127.0.0.2", "127.0.0.3", "127.0.0.4"}},
+	}
+	hl := &scan.HostsList{}
+	hl.Add("multi")
+
+	// the 4 probes share the rate of the host instead of getting one each
+	start := time.Now()
+	res := scan.Run(hl, []int{1}, scan.Options{Resolver: resolver, AllAddresses: true, HostRate: 20})
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("expected the scan to take at least 140ms, took %s instead\n", elapsed)
+	}
+	if len(res) != 4 {
+		t.Errorf("expected 4 results, got %d instead\n", len(res))
+	}
+}
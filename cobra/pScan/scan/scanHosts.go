@@ -1,67 +1,570 @@
 package scan
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"syscall"
 	"time"
 )
 
+const (
+	// DefaultConcurrency is the number of parallel probes when none is set
+	DefaultConcurrency = 100
+	// DefaultTimeout is the time a probe waits for an answer when none is set
+	DefaultTimeout = 1 * time.Second
+)
+
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
 type PortState struct {
-	Port int
-	Open state
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Service  string `json:"service,omitempty"`
+	State    state  `json:"state"`
+	// Latency is the time the port took to answer, 0 if it did not
+	Latency time.Duration `json:"latency_ns,omitempty"`
+	// Reason tells what the state is based on
+	Reason string `json:"reason,omitempty"`
+	// Banner is the first line the service sent when banners are grabbed,
+	// and Version the software version identified from it
+	Banner  string `json:"banner,omitempty"`
+	Version string `json:"version,omitempty"`
+	// TLS describes the TLS session and certificate of the port when it was
+	// inspected
+	TLS *TLSInfo `json:"tls,omitempty"`
 }
 
-type state bool
+type state int
 
-// string converts the boolean value of state to a more human readable string
+const (
+	StateClosed state = iota
+	StateOpen
+	// StateFiltered is a TCP port that did not answer, most likely because a
+	// firewall dropped the probe
+	StateFiltered
+	// StateOpenFiltered is a UDP port that neither answered nor was reported
+	// unreachable, either open and silent or behind a firewall
+	StateOpenFiltered
+)
+
+// String converts the value of state to a more human readable string
 func (s state) String() string {
-	if s {
+	switch s {
+	case StateOpen:
 		return "open"
+	case StateFiltered:
+		return "filtered"
+	case StateOpenFiltered:
+		return "open|filtered"
 	}
 	return "closed"
 }
 
-func scanPort(host string, port int) PortState {
+func (s state) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *state) UnmarshalText(text []byte) error {
+	for _, st := range []state{StateClosed, StateOpen, StateFiltered, StateOpenFiltered} {
+		if st.String() == string(text) {
+			*s = st
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown port state %q", text)
+}
+
+// errorReason returns a short reason for a probe error
+func errorReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return "host-unreach"
+	case errors.Is(err, syscall.ENETUNREACH):
+		return "net-unreach"
+	}
+	return err.Error()
+}
+
+// scanPort connects to a TCP port. The port is open if the connection is
+// established, closed if it is refused and filtered if it times out or an
+// ICMP error comes back. The banner of open ports is grabbed if requested,
+// host naming the server in the probes of the banners.
+func scanPort(ctx context.Context, host, addr string, port int, timeout time.Duration, banners bool) PortState {
 	p := PortState{
-		Port: port,
-		Open: false, // this is redundant as default bool is false
+		Port:     port,
+		Protocol: TCP,
+		Service:  ServiceName(TCP, port),
+		State:    StateClosed, // this is redundant as it is the zero value
 	}
 
-	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	scanConn, err := net.DialTimeout("tcp", address, 1*time.Second)
+	address := net.JoinHostPort(addr, fmt.Sprintf("%d", port))
+	start := time.Now()
+	dialer := net.Dialer{Timeout: timeout}
+	scanConn, err := dialer.DialContext(ctx, "tcp", address)
 
 	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			p.Latency = time.Since(start)
+			p.Reason = "reset"
+			return p
+		}
+		p.State = StateFiltered
+		p.Reason = errorReason(err)
 		return p
 	}
 
-	scanConn.Close()
-	p.Open = true
+	p.Latency = time.Since(start)
+	defer scanConn.Close()
+	p.State = StateOpen
+	p.Reason = "syn-ack"
+
+	if banners {
+		defer abortOnCancel(ctx, scanConn)()
+		service, version, banner := grabBanner(scanConn, host, timeout)
+		if service != "" {
+			p.Service = service
+		}
+		p.Version, p.Banner = version, banner
+	}
 	return p
 }
 
 type Results struct {
-	Host       string
-	NotFound   bool
-	PortStates []PortState
+	Host     string `json:"host"`
+	NotFound bool   `json:"not_found,omitempty"`
+	// Status is the result of the discovery of the host, and Addresses the
+	// addresses its name resolved to
+	Status    hostStatus `json:"status,omitempty"`
+	Addresses []string   `json:"addresses,omitempty"`
+	// Address is the address of the host that was scanned, and Names its
+	// PTR names when they were looked up
+	Address    string      `json:"address,omitempty"`
+	Names      []string    `json:"names,omitempty"`
+	PortStates []PortState `json:"ports,omitempty"`
 }
 
-func Run(hl *HostsList, ports []int) []Results {
-	res := make([]Results, 0, len(hl.Hosts))
+// Options tunes how a scan spreads its probes
+type Options struct {
+	// Concurrency is the maximum number of parallel lookups and probes,
+	// DefaultConcurrency if not positive
+	Concurrency int
+	// HostRate is the maximum number of probes per second sent to a single
+	// host, 0 for no limit
+	HostRate float64
+	// Protocol is the protocol of the scanned ports, TCP if empty
+	Protocol string
+	// Timeout is the time a probe waits for an answer, DefaultTimeout if not
+	// positive
+	Timeout time.Duration
+	// Banners enables reading the banner of the open TCP ports to identify
+	// their service and version
+	Banners bool
+	// Discovery pings the hosts before scanning them, leaving out the hosts
+	// that are down
+	Discovery bool
+	// DiscoveryPorts are the ports of the TCP ping, DefaultDiscoveryPorts if
+	// empty
+	DiscoveryPorts []int
+	// TLS inspects the certificates of the open TLS ports, those of TLSPorts
+	// or DefaultTLSPorts if empty
+	TLS      bool
+	TLSPorts []int
+	// ExpiryDays is the number of days before their expiry certificates are
+	// flagged as expiring, DefaultExpiryDays if not positive
+	ExpiryDays int
+	// Resolver looks up the addresses and names of the hosts,
+	// net.DefaultResolver if nil
+	Resolver Resolver
+	// AllAddresses scans every address of the hosts instead of the first
+	// one only
+	AllAddresses bool
+	// ReverseDNS looks up the PTR names of the scanned addresses
+	ReverseDNS bool
+	// OnHost is called with the results of every host once complete, in the
+	// order the hosts complete in
+	OnHost func(Results)
+	// OnProgress is called as the scan progresses
+	OnProgress func(Progress)
+}
 
-	for _, h := range hl.Hosts {
-		r := Results{
-			Host: h,
+// Progress tells how far a scan went
+type Progress struct {
+	// HostsDone of the Hosts of the scan have all their ports scanned, were
+	// not found or are down. Every address of the hosts scanned on all of
+	// them counts as a host once they are resolved.
+	HostsDone int `json:"hosts_done"`
+	Hosts     int `json:"hosts"`
+	// ProbesDone of the Probes to send are done, Probes being only known once
+	// the hosts are resolved and discovered
+	ProbesDone int `json:"probes_done"`
+	Probes     int `json:"probes"`
+}
+
+// hostLimiter spaces out the probes to a host to honour its rate
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next probe slot of the host or ctx is done
+func (l *hostLimiter) wait(ctx context.Context) {
+	if l.interval == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// abortOnCancel unblocks the reads and writes on conn when ctx is done, until
+// the returned function is called
+func abortOnCancel(ctx context.Context, conn net.Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
 		}
-		if _, err := net.LookupHost(h); err != nil {
-			r.NotFound = true
+	}()
+	return func() { close(done) }
+}
+
+// parallel calls fn for every index below n, at most concurrency at a time,
+// until ctx is done
+func parallel(ctx context.Context, n, concurrency int, fn func(i int)) {
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+
+	if concurrency > n {
+		concurrency = n
+	}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Run scans the ports of the hosts until it is done. It is RunContext
+// without cancellation.
+func Run(hl *HostsList, ports []int, opts Options) []Results {
+	res, _ := RunContext(context.Background(), hl, ports, opts)
+	return res
+}
+
+// RunContext scans the ports of the hosts with a pool of workers. The entries
+// of the list are expanded to the hosts they stand for, an entry that cannot
+// be expanded or a host that cannot be resolved being reported as not found.
+// The hosts are scanned on their first address, IPv4 addresses coming first,
+// or on every one of them with AllAddresses, each address getting its own
+// results. With discovery, the addresses that do not answer the ping are
+// reported down and not scanned. Hosts with their own ports are scanned on
+// those instead of ports. With TLS, the open TLS ports are inspected too. The
+// results keep the order of the hosts, addresses and ports whatever the order
+// the probes complete in.
+//
+// When ctx is done, the scan stops and returns the partial results with the
+// error of ctx: the hosts resolved so far, with the ports scanned so far.
+func RunContext(ctx context.Context, hl *HostsList, ports []int, opts Options) ([]Results, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	discoveryPorts := opts.DiscoveryPorts
+	if len(discoveryPorts) == 0 {
+		discoveryPorts = DefaultDiscoveryPorts
+	}
+	tlsPorts := make(map[int]bool)
+	if len(opts.TLSPorts) == 0 {
+		opts.TLSPorts = DefaultTLSPorts
+	}
+	for _, p := range opts.TLSPorts {
+		tlsPorts[p] = true
+	}
+	expiryDays := opts.ExpiryDays
+	if expiryDays <= 0 {
+		expiryDays = DefaultExpiryDays
+	}
+	var resolver Resolver = net.DefaultResolver
+	if opts.Resolver != nil {
+		resolver = opts.Resolver
+	}
+	var interval time.Duration
+	if opts.HostRate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.HostRate)
+	}
+
+	hosts := []Results{}
+	// hostPorts are the ports to scan on each host
+	hostPorts := [][]int{}
+	seen := make(map[string]bool)
+	for _, entry := range hl.Hosts {
+		expanded, err := ExpandTarget(entry.Name)
+		if err != nil {
+			hosts = append(hosts, Results{Host: entry.Name, NotFound: true})
+			hostPorts = append(hostPorts, nil)
+			continue
+		}
+		for _, h := range expanded {
+			if !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, Results{Host: h})
+				hostPorts = append(hostPorts, entry.scanPorts(ports))
+			}
+		}
+	}
+
+	// the callbacks are called one at a time
+	var mu sync.Mutex
+	progress := Progress{Hosts: len(hosts)}
+	hostDone := func(r Results) {
+		progress.HostsDone++
+		if opts.OnHost != nil {
+			opts.OnHost(r)
+		}
+	}
+	reportProgress := func() {
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	}
+
+	resolved := make([]bool, len(hosts))
+	parallel(ctx, len(hosts), concurrency, func(i int) {
+		if !hosts[i].NotFound {
+			addrs, err := resolver.LookupHost(ctx, hosts[i].Host)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil || len(addrs) == 0 {
+				hosts[i].NotFound = true
+			} else {
+				hosts[i].Addresses = ipv4First(addrs)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		resolved[i] = true
+		if hosts[i].NotFound {
+			hostDone(hosts[i])
+			reportProgress()
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return partialResults(hosts, resolved, nil), err
+	}
+
+	// the results of the addresses scanned, with the host and the ports to
+	// scan of each of them and the count of the ports left to scan
+	res := []Results{}
+	resHost := []int{}
+	resPorts := [][]int{}
+	for i, h := range hosts {
+		if h.NotFound {
+			res = append(res, h)
+			resHost = append(resHost, i)
+			resPorts = append(resPorts, nil)
+			continue
+		}
+		addrs := h.Addresses[:1]
+		if opts.AllAddresses {
+			addrs = h.Addresses
+		}
+		for _, addr := range addrs {
+			r := h
+			r.Address = addr
 			res = append(res, r)
+			resHost = append(resHost, i)
+			resPorts = append(resPorts, hostPorts[i])
+		}
+	}
+	progress.Hosts += len(res) - len(hosts)
+	checked := make([]bool, len(res))
+	left := make([]int, len(res))
+	done := make([][]bool, len(res))
+	for i := range res {
+		checked[i] = res[i].NotFound
+	}
+
+	// the addresses are probed at the rate of their host, shared by all of
+	// its addresses, from the discovery ping to the port scan
+	hostLimiters := make([]*hostLimiter, len(hosts))
+	limiters := make([]*hostLimiter, len(res))
+	for i := range res {
+		if res[i].NotFound {
 			continue
 		}
-		for _, p := range ports {
-			r.NotFound = false // this is redundant as default bool is false
-			r.PortStates = append(r.PortStates, scanPort(h, p))
+		h := resHost[i]
+		if hostLimiters[h] == nil {
+			hostLimiters[h] = &hostLimiter{interval: interval}
 		}
-		res = append(res, r)
+		limiters[i] = hostLimiters[h]
 	}
-	return res
+	if opts.ReverseDNS {
+		parallel(ctx, len(res), concurrency, func(i int) {
+			if !res[i].NotFound {
+				res[i].Names = reverseNames(ctx, resolver, res[i].Address)
+			}
+		})
+	}
+	if opts.Discovery {
+		discover(ctx, res, limiters, discoveryPorts, concurrency, timeout)
+	}
+	if err := ctx.Err(); err != nil {
+		return partialResults(res, checked, nil), err
+	}
+
+	mu.Lock()
+	for i := range res {
+		if res[i].NotFound {
+			continue
+		}
+		if res[i].Status != StatusDown {
+			res[i].PortStates = make([]PortState, len(resPorts[i]))
+			done[i] = make([]bool, len(resPorts[i]))
+			left[i] = len(resPorts[i])
+		}
+		checked[i] = true
+		if left[i] == 0 {
+			hostDone(res[i])
+			reportProgress()
+		}
+	}
+	mu.Unlock()
+
+	// one job per address and port, ports first so that the workers spread
+	// over the addresses instead of queuing behind the rate limit of a
+	// single one
+	type job struct{ host, port int }
+	var jobs []job
+	for p, more := 0, true; more; p++ {
+		more = false
+		for i := range res {
+			if p < len(res[i].PortStates) {
+				jobs = append(jobs, job{i, p})
+				more = true
+			}
+		}
+	}
+	progress.Probes = len(jobs)
+	mu.Lock()
+	reportProgress()
+	mu.Unlock()
+
+	parallel(ctx, len(jobs), concurrency, func(j int) {
+		i, p := jobs[j].host, jobs[j].port
+		limiters[i].wait(ctx)
+
+		var ps PortState
+		if opts.Protocol == UDP {
+			ps = scanUDPPort(ctx, res[i].Address, resPorts[i][p], timeout)
+		} else {
+			ps = scanPort(ctx, res[i].Host, res[i].Address, resPorts[i][p], timeout, opts.Banners)
+			if opts.TLS && ps.State == StateOpen && tlsPorts[ps.Port] {
+				limiters[i].wait(ctx)
+				ps.TLS = inspectTLS(ctx, res[i].Host, res[i].Address, ps.Port, timeout, expiryDays)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		// the probes cut short by the cancellation tell nothing of the port
+		if ctx.Err() != nil {
+			return
+		}
+		res[i].PortStates[p] = ps
+		done[i][p] = true
+		left[i]--
+		progress.ProbesDone++
+		if left[i] == 0 {
+			hostDone(res[i])
+		}
+		reportProgress()
+	})
+
+	if err := ctx.Err(); err != nil {
+		return partialResults(res, checked, done), err
+	}
+	return res, nil
+}
+
+// ipv4First orders the IPv4 addresses before the IPv6 ones, keeping their
+// order otherwise, so that the hosts are scanned on IPv4 first as nmap does
+func ipv4First(addrs []string) []string {
+	is4 := func(a string) bool {
+		ip, err := netip.ParseAddr(a)
+		return err == nil && ip.Unmap().Is4()
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return is4(addrs[i]) && !is4(addrs[j])
+	})
+	return addrs
+}
+
+// partialResults keeps the hosts checked before the scan was cancelled, with
+// the ports scanned on them
+func partialResults(res []Results, checked []bool, done [][]bool) []Results {
+	partial := []Results{}
+	for i, r := range res {
+		if !checked[i] {
+			continue
+		}
+		if r.PortStates != nil {
+			states := []PortState{}
+			for p, ps := range r.PortStates {
+				if done[i][p] {
+					states = append(states, ps)
+				}
+			}
+			r.PortStates = states
+		}
+		partial = append(partial, r)
+	}
+	return partial
 }
@@ -1,9 +1,13 @@
 package scan_test
 
 import (
+	"context"
+	"errors"
 	"net"
+	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/boeboe/learngo/cobra/pScan/scan"
 )
@@ -11,23 +15,34 @@ import (
 func TestStateString(t *testing.T) {
 	ps := scan.PortState{}
 
-	if ps.Open.String() != "closed" {
-		t.Errorf("expected port state %q, but got %q instead", "closed", ps.Open.String())
+	if ps.State.String() != "closed" {
+		t.Errorf("expected port state %q, but got %q instead", "closed", ps.State.String())
 	}
 
-	ps.Open = true
-	if ps.Open.String() != "open" {
-		t.Errorf("expected port state %q, but got %q instead", "open", ps.Open.String())
+	ps.State = scan.StateOpen
+	if ps.State.String() != "open" {
+		t.Errorf("expected port state %q, but got %q instead", "open", ps.State.String())
+	}
+
+	ps.State = scan.StateFiltered
+	if ps.State.String() != "filtered" {
+		t.Errorf("expected port state %q, but got %q instead", "filtered", ps.State.String())
+	}
+
+	ps.State = scan.StateOpenFiltered
+	if ps.State.String() != "open|filtered" {
+		t.Errorf("expected port state %q, but got %q instead", "open|filtered", ps.State.String())
 	}
 }
 
 func TestRunHostFound(t *testing.T) {
 	testCases := []struct {
-		name     string
-		expState string
+		name      string
+		expState  string
+		expReason string
 	}{
-		{name: "OpenPort", expState: "open"},
-		{name: "ClosedPort", expState: "closed"},
+		{name: "OpenPort", expState: "open", expReason: "syn-ack"},
+		{name: "ClosedPort", expState: "closed", expReason: "reset"},
 	}
 
 	host := "localhost"
@@ -57,7 +72,7 @@ func TestRunHostFound(t *testing.T) {
 		}
 	}
 
-	res := scan.Run(hl, ports)
+	res := scan.Run(hl, ports, scan.Options{})
 
 	// verify results for HostFound test
 	if len(res) != 1 {
@@ -76,8 +91,14 @@ func TestRunHostFound(t *testing.T) {
 		if res[0].PortStates[i].Port != ports[i] {
 			t.Errorf("unexpected port %d, got %d instead\n", ports[i], res[0].PortStates[i].Port)
 		}
-		if res[0].PortStates[i].Open.String() != tc.expState {
-			t.Errorf("expected port %d to be %s, got %s instead\n", ports[i], tc.expState, res[0].PortStates[i].Open.String())
+		if res[0].PortStates[i].State.String() != tc.expState {
+			t.Errorf("expected port %d to be %s, got %s instead\n", ports[i], tc.expState, res[0].PortStates[i].State.String())
+		}
+		if res[0].PortStates[i].Reason != tc.expReason {
+			t.Errorf("expected port %d reason %q, got %q instead\n", ports[i], tc.expReason, res[0].PortStates[i].Reason)
+		}
+		if res[0].PortStates[i].Latency <= 0 {
+			t.Errorf("expected port %d latency to be measured\n", ports[i])
 		}
 	}
 }
@@ -87,7 +108,7 @@ func TestRunHostNotFound(t *testing.T) {
 	hl := &scan.HostsList{}
 	hl.Add(host)
 
-	res := scan.Run(hl, []int{})
+	res := scan.Run(hl, []int{}, scan.Options{})
 
 	// verify results for HostNotFound test
 	if len(res) != 1 {
@@ -103,3 +124,208 @@ func TestRunHostNotFound(t *testing.T) {
 		t.Fatalf("expected 0 port states, got %d instead\n", len(res[0].PortStates))
 	}
 }
+
+func TestRunConcurrent(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        scan.Options
+		minDuration time.Duration
+	}{
+		{name: "Default", opts: scan.Options{}},
+		{name: "SingleWorker", opts: scan.Options{Concurrency: 1}},
+		{name: "HostRate", opts: scan.Options{HostRate: 50}, minDuration: 180 * time.Millisecond},
+	}
+
+	hosts := []string{"localhost", "127.0.0.1", "389.389.389.389"}
+	hl := &scan.HostsList{}
+	for _, h := range hosts {
+		hl.Add(h)
+	}
+
+	// every other port is open
+	ports := []int{}
+	for i := 0; i < 10; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		ports = append(ports, ln.Addr().(*net.TCPAddr).Port)
+
+		if i%2 == 1 {
+			ln.Close()
+		}
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			res := scan.Run(hl, ports, tc.opts)
+			if d := time.Since(start); d < tc.minDuration {
+				t.Errorf("expected scan to take at least %s, took %s", tc.minDuration, d)
+			}
+
+			if len(res) != len(hl.Hosts) {
+				t.Fatalf("expected %d results, got %d instead", len(hl.Hosts), len(res))
+			}
+			for i, r := range res {
+				if r.Host != hl.Hosts[i].Name {
+					t.Errorf("expected host %q at %d, got %q instead", hl.Hosts[i].Name, i, r.Host)
+				}
+				if r.Host == "389.389.389.389" {
+					if !r.NotFound || len(r.PortStates) != 0 {
+						t.Errorf("expected host %q NOT to be found", r.Host)
+					}
+					continue
+				}
+				if len(r.PortStates) != len(ports) {
+					t.Fatalf("expected %d port states, got %d instead", len(ports), len(r.PortStates))
+				}
+				for j, ps := range r.PortStates {
+					expState := "open"
+					if j%2 == 1 {
+						expState = "closed"
+					}
+					if ps.Port != ports[j] || ps.State.String() != expState {
+						t.Errorf("%s: expected port %d %s, got %d %s instead", r.Host, ports[j], expState, ps.Port, ps.State)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRunFiltered(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	hl := &scan.HostsList{}
+	hl.Add("127.0.0.1")
+
+	// a timeout too short for any connection to complete
+	port := ln.Addr().(*net.TCPAddr).Port
+	res := scan.Run(hl, []int{port}, scan.Options{Timeout: time.Nanosecond})
+
+	if len(res) != 1 || len(res[0].PortStates) != 1 {
+		t.Fatalf("expected 1 result with 1 port state, got %+v instead", res)
+	}
+	ps := res[0].PortStates[0]
+	if ps.State != scan.StateFiltered {
+		t.Errorf("expected port to be filtered, got %s (%s) instead", ps.State, ps.Reason)
+	}
+	if ps.Reason != "timeout" || ps.Latency != 0 {
+		t.Errorf("expected timeout reason and no latency, got %q and %s instead", ps.Reason, ps.Latency)
+	}
+}
+
+func TestRunHostPorts(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	hl := &scan.HostsList{Hosts: []scan.Host{
+		{Name: "127.0.0.1", Ports: []string{strconv.Itoa(port), "1-2"}},
+		{Name: "localhost"},
+	}}
+
+	res := scan.Run(hl, []int{port}, scan.Options{})
+	if len(res) != 2 {
+		t.Fatalf("expected 2 results, got %+v instead", res)
+	}
+	expPorts := [][]int{{port, 1, 2}, {port}}
+	for i, r := range res {
+		var ports []int
+		for _, ps := range r.PortStates {
+			ports = append(ports, ps.Port)
+		}
+		if !reflect.DeepEqual(ports, expPorts[i]) {
+			t.Errorf("expected %s to be scanned on %v, got %v instead", r.Host, expPorts[i], ports)
+		}
+	}
+	if res[0].PortStates[0].State != scan.StateOpen {
+		t.Errorf("expected port %d to be open, got %s instead", port, res[0].PortStates[0].State)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	ports := []int{}
+	for i := 0; i < 4; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		ports = append(ports, ln.Addr().(*net.TCPAddr).Port)
+	}
+
+	hl := &scan.HostsList{}
+	for _, h := range []string{"127.0.0.1", "localhost", "389.389.389.389"} {
+		if err := hl.Add(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		var hosts []string
+		var last scan.Progress
+		opts := scan.Options{
+			OnHost:     func(r scan.Results) { hosts = append(hosts, r.Host) },
+			OnProgress: func(p scan.Progress) { last = p },
+		}
+
+		res, err := scan.RunContext(context.Background(), hl, ports, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %q instead\n", err)
+		}
+		if len(res) != 3 || len(hosts) != 3 {
+			t.Fatalf("expected 3 results and 3 completed hosts, got %d and %v instead\n", len(res), hosts)
+		}
+		expProgress := scan.Progress{HostsDone: 3, Hosts: 3, ProbesDone: 8, Probes: 8}
+		if last != expProgress {
+			t.Errorf("expected final progress %+v, got %+v instead\n", expProgress, last)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// a probe every 50ms per host, cancelled after the first probe
+		opts := scan.Options{
+			HostRate: 20,
+			OnProgress: func(p scan.Progress) {
+				if p.ProbesDone > 0 {
+					cancel()
+				}
+			},
+		}
+
+		start := time.Now()
+		res, err := scan.RunContext(ctx, hl, ports, opts)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected error %q, got %v instead\n", context.Canceled, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("expected scan to stop on cancel, took %s", d)
+		}
+
+		probes := 0
+		for _, r := range res {
+			for _, ps := range r.PortStates {
+				if ps.State != scan.StateOpen {
+					t.Errorf("expected only the completed probes, got %+v\n", ps)
+				}
+				probes++
+			}
+		}
+		if probes == 0 || probes >= 8 {
+			t.Errorf("expected partial results, got %d probes instead\n", probes)
+		}
+	})
+}
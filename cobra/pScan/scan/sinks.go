@@ -0,0 +1,93 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Sink receives the alerts of a monitor
+type Sink interface {
+	Notify(alerts []Alert) error
+}
+
+// WriterSink writes the alerts to W, one per line
+type WriterSink struct {
+	W io.Writer
+}
+
+func (s *WriterSink) Notify(alerts []Alert) error {
+	message := ""
+	for _, a := range alerts {
+		message += fmt.Sprintf("%s %s\n", a.Time.Format(time.RFC3339), a.Change)
+	}
+	_, err := io.WriteString(s.W, message)
+	return err
+}
+
+// ExecSink runs a shell command for each alert, passing it in the
+// PSCAN_HOST, PSCAN_ADDRESS, PSCAN_CHANGE, PSCAN_PORT, PSCAN_PROTOCOL and
+// PSCAN_SERVICE environment variables, and as JSON on the standard input
+type ExecSink struct {
+	Command string
+}
+
+func (s *ExecSink) Notify(alerts []Alert) error {
+	for _, a := range alerts {
+		js, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command("sh", "-c", s.Command)
+		cmd.Env = append(os.Environ(),
+			"PSCAN_HOST="+a.Host,
+			"PSCAN_ADDRESS="+a.Address,
+			"PSCAN_CHANGE="+a.Kind.String(),
+			"PSCAN_PORT="+strconv.Itoa(a.Port),
+			"PSCAN_PROTOCOL="+a.Protocol,
+			"PSCAN_SERVICE="+a.Service,
+		)
+		cmd.Stdin = bytes.NewReader(js)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("alert command %q: %w: %s", s.Command, err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+// WebhookSink posts the alerts of a scan to URL as a JSON document of the
+// form {"alerts": [...]}
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Notify(alerts []Alert) error {
+	js, err := json.Marshal(struct {
+		Alerts []Alert `json:"alerts"`
+	}{alerts})
+	if err != nil {
+		return err
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Post(s.URL, "application/json", bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("alert webhook %s: %s", s.URL, resp.Status)
+	}
+	return nil
+}
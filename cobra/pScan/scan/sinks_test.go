@@ -0,0 +1,88 @@
+package scan_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+var testAlerts = []scan.Alert{
+	{Time: time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		Change: scan.Change{Host: "host1", Kind: scan.PortOpened, Port: 22, Protocol: scan.TCP, Service: "ssh"}},
+	{Time: time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		Change: scan.Change{Host: "host2", Kind: scan.HostDisappeared}},
+}
+
+func TestWriterSink(t *testing.T) {
+	var out bytes.Buffer
+	s := &scan.WriterSink{W: &out}
+	if err := s.Notify(testAlerts); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+
+	expected := "2022-10-01T12:00:00Z + host1: 22/tcp (ssh) opened\n2022-10-01T12:00:00Z - host2: host disappeared\n"
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q instead\n", expected, out.String())
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "alerts")
+
+	s := &scan.ExecSink{Command: `echo "$PSCAN_HOST $PSCAN_CHANGE $PSCAN_PORT $PSCAN_PROTOCOL $(cat)" >> ` + out}
+	if err := s.Notify(testAlerts[:1]); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `host1 opened 22 tcp {"time":"2022-10-01T12:00:00Z","host":"host1","change":"opened","port":22,"protocol":"tcp","service":"ssh"}` + "\n"
+	if string(content) != expected {
+		t.Errorf("expected command output %q, got %q instead\n", expected, content)
+	}
+
+	s = &scan.ExecSink{Command: "echo failed; exit 1"}
+	if err := s.Notify(testAlerts[:1]); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("expected error with the command output, got %v instead\n", err)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received struct {
+		Alerts []json.RawMessage `json:"alerts"`
+	}
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	s := &scan.WebhookSink{URL: ts.URL}
+	if err := s.Notify(testAlerts); err != nil {
+		t.Fatalf("expected no error, got %q instead\n", err)
+	}
+	if len(received.Alerts) != 2 {
+		t.Errorf("expected 2 alerts, got %d instead\n", len(received.Alerts))
+	}
+
+	status = http.StatusInternalServerError
+	if err := s.Notify(testAlerts); err == nil {
+		t.Errorf("expected error on status %d, got nil instead\n", status)
+	}
+}
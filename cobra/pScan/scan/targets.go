@@ -0,0 +1,152 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MaxTargets is the maximum number of hosts a single entry can expand to
+const MaxTargets = 65536
+
+// targetFilePrefix marks an entry naming a file of targets, one per line
+const targetFilePrefix = "@"
+
+// IsExpandable reports whether an entry stands for several hosts
+func IsExpandable(entry string) bool {
+	if strings.HasPrefix(entry, targetFilePrefix) || strings.Contains(entry, "/") {
+		return true
+	}
+	from, _, ok := strings.Cut(entry, "-")
+	if !ok {
+		return false
+	}
+	_, err := netip.ParseAddr(from)
+	return err == nil
+}
+
+// expandPrefix returns the addresses of a CIDR block such as 10.0.0.0/28 or
+// 2001:db8::/120
+func expandPrefix(entry string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTarget, err)
+	}
+	prefix = prefix.Masked()
+
+	if hostBits := prefix.Addr().BitLen() - prefix.Bits(); hostBits > 16 {
+		return nil, fmt.Errorf("%w: %s has more than %d addresses", ErrTooManyTargets, entry, MaxTargets)
+	}
+
+	hosts := []string{}
+	for a := prefix.Addr(); a.IsValid() && prefix.Contains(a); a = a.Next() {
+		hosts = append(hosts, a.String())
+	}
+	return hosts, nil
+}
+
+// expandRange returns the addresses of an inclusive range, given either as
+// two addresses of the same family or as an IPv4 address followed by the
+// last byte of the range, such as 10.0.0.1-20
+func expandRange(entry string) ([]string, error) {
+	from, to, _ := strings.Cut(entry, "-")
+	start, err := netip.ParseAddr(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTarget, err)
+	}
+
+	end, err := netip.ParseAddr(to)
+	if err != nil {
+		last, convErr := strconv.Atoi(to)
+		if !start.Is4() || convErr != nil || last < 0 || last > 255 {
+			return nil, fmt.Errorf("%w: invalid range end %q", ErrInvalidTarget, to)
+		}
+		b := start.As4()
+		b[3] = byte(last)
+		end = netip.AddrFrom4(b)
+	}
+
+	if start.BitLen() != end.BitLen() || end.Less(start) {
+		return nil, fmt.Errorf("%w: invalid range %q", ErrInvalidTarget, entry)
+	}
+
+	hosts := []string{}
+	for a := start; a.IsValid() && !end.Less(a); a = a.Next() {
+		if len(hosts) == MaxTargets {
+			return nil, fmt.Errorf("%w: %s has more than %d addresses", ErrTooManyTargets, entry, MaxTargets)
+		}
+		hosts = append(hosts, a.String())
+	}
+	return hosts, nil
+}
+
+// expandFile returns the targets listed in a file, one per line, skipping
+// blank lines and # comments. Files cannot refer to other files.
+func expandFile(entry string) ([]string, error) {
+	name := strings.TrimPrefix(entry, targetFilePrefix)
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hosts := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, targetFilePrefix) {
+			return nil, fmt.Errorf("%w: nested target file %q in %s", ErrInvalidTarget, line, name)
+		}
+		expanded, err := ExpandTarget(line)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+		if len(hosts) > MaxTargets {
+			return nil, fmt.Errorf("%w: %s has more than %d targets", ErrTooManyTargets, name, MaxTargets)
+		}
+	}
+	return hosts, scanner.Err()
+}
+
+// ExpandTarget returns the hosts of a hosts list entry: a CIDR block, an
+// address range, a file of targets prefixed with @ or a single host. Hostname
+// globs such as web*.example.com are rejected, as there is nothing to match
+// them against.
+func ExpandTarget(entry string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(entry, targetFilePrefix):
+		return expandFile(entry)
+	case strings.Contains(entry, "/"):
+		return expandPrefix(entry)
+	case IsExpandable(entry):
+		return expandRange(entry)
+	}
+
+	if entry == "" || strings.ContainsAny(entry, " \t") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTarget, entry)
+	}
+	// strip the brackets of IPv6 addresses written as in URLs
+	if strings.HasPrefix(entry, "[") && strings.HasSuffix(entry, "]") {
+		if a, err := netip.ParseAddr(entry[1 : len(entry)-1]); err == nil {
+			return []string{a.String()}, nil
+		}
+	}
+	if strings.ContainsAny(entry, "*?[]") {
+		return nil, fmt.Errorf("%w: hostname glob %q", ErrUnsupported, entry)
+	}
+	return []string{entry}, nil
+}
+
+// ValidateTarget checks the syntax of a hosts list entry, and that the file
+// of targets it refers to can be read
+func ValidateTarget(entry string) error {
+	_, err := ExpandTarget(entry)
+	return err
+}
@@ -0,0 +1,125 @@
+package scan_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+func TestExpandTarget(t *testing.T) {
+	dir := t.TempDir()
+	targetsFile := filepath.Join(dir, "targets")
+	if err := os.WriteFile(targetsFile, []byte("# lab hosts\nhost1\n\n10.0.0.1-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nestedFile := filepath.Join(dir, "nested")
+	if err := os.WriteFile(nestedFile, []byte("@"+targetsFile+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		entry    string
+		expHosts []string
+		expLen   int
+		expErr   error
+	}{
+		{name: "Host", entry: "host1", expHosts: []string{"host1"}},
+		{name: "IPv6", entry: "2001:db8::1", expHosts: []string{"2001:db8::1"}},
+		{name: "IPv6Brackets", entry: "[2001:db8::1]", expHosts: []string{"2001:db8::1"}},
+		{name: "HyphenatedHost", entry: "web-1.example.com", expHosts: []string{"web-1.example.com"}},
+		{name: "CIDR", entry: "10.0.0.0/30",
+			expHosts: []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{name: "CIDRUnmasked", entry: "10.0.0.5/31", expHosts: []string{"10.0.0.4", "10.0.0.5"}},
+		{name: "CIDRLarge", entry: "10.0.0.0/16", expLen: 65536},
+		{name: "CIDRIPv6", entry: "2001:db8::/126",
+			expHosts: []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{name: "ShortRange", entry: "10.0.0.1-3", expHosts: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{name: "FullRange", entry: "10.0.0.254-10.0.1.1",
+			expHosts: []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{name: "RangeIPv6", entry: "2001:db8::ff-2001:db8::101",
+			expHosts: []string{"2001:db8::ff", "2001:db8::100", "2001:db8::101"}},
+		{name: "File", entry: "@" + targetsFile, expHosts: []string{"host1", "10.0.0.1", "10.0.0.2"}},
+		{name: "Empty", entry: "", expErr: scan.ErrInvalidTarget},
+		{name: "Spaces", entry: "host 1", expErr: scan.ErrInvalidTarget},
+		{name: "Glob", entry: "web*.example.com", expErr: scan.ErrUnsupported},
+		{name: "GlobClass", entry: "db[1-3]", expErr: scan.ErrUnsupported},
+		{name: "InvalidCIDR", entry: "10.0.0.0/33", expErr: scan.ErrInvalidTarget},
+		{name: "CIDRTooLarge", entry: "2001:db8::/64", expErr: scan.ErrTooManyTargets},
+		{name: "ReversedRange", entry: "10.0.0.9-1", expErr: scan.ErrInvalidTarget},
+		{name: "RangeEndTooHigh", entry: "10.0.0.1-256", expErr: scan.ErrInvalidTarget},
+		{name: "MixedFamilies", entry: "10.0.0.1-2001:db8::1", expErr: scan.ErrInvalidTarget},
+		{name: "ShortRangeIPv6", entry: "2001:db8::1-5", expErr: scan.ErrInvalidTarget},
+		{name: "RangeTooLarge", entry: "10.0.0.0-10.2.0.0", expErr: scan.ErrTooManyTargets},
+		{name: "NestedFile", entry: "@" + nestedFile, expErr: scan.ErrInvalidTarget},
+		{name: "MissingFile", entry: "@" + filepath.Join(dir, "missing"), expErr: os.ErrNotExist},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts, err := scan.ExpandTarget(tc.entry)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("expected error %q, got %q instead", tc.expErr, err)
+				}
+				if scan.ValidateTarget(tc.entry) == nil {
+					t.Errorf("expected entry %q to be invalid", tc.entry)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %q instead", err)
+			}
+			if tc.expLen > 0 {
+				if len(hosts) != tc.expLen {
+					t.Errorf("expected %d hosts, got %d instead", tc.expLen, len(hosts))
+				}
+				return
+			}
+			if !reflect.DeepEqual(hosts, tc.expHosts) {
+				t.Errorf("expected hosts %v, got %v instead", tc.expHosts, hosts)
+			}
+		})
+	}
+}
+
+func TestRunRange(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	hl := &scan.HostsList{}
+	for _, h := range []string{"127.0.0.1-2", "127.0.0.1", "10.0.0.0/33"} {
+		hl.Hosts = append(hl.Hosts, scan.Host{Name: h})
+	}
+
+	res := scan.Run(hl, []int{port}, scan.Options{})
+
+	expHosts := []string{"127.0.0.1", "127.0.0.2", "10.0.0.0/33"}
+	expStates := []string{"open", "closed", ""}
+	if len(res) != len(expHosts) {
+		t.Fatalf("expected %d results, got %+v instead", len(expHosts), res)
+	}
+	for i, r := range res {
+		if r.Host != expHosts[i] {
+			t.Errorf("expected host %q, got %q instead", expHosts[i], r.Host)
+		}
+		if expStates[i] == "" {
+			if !r.NotFound {
+				t.Errorf("expected invalid entry %q to be reported as not found", r.Host)
+			}
+			continue
+		}
+		if r.NotFound || r.PortStates[0].State.String() != expStates[i] {
+			t.Errorf("expected %s to be %s, got %+v instead", r.Host, expStates[i], r)
+		}
+	}
+}
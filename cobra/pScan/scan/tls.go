@@ -0,0 +1,98 @@
+package scan
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultTLSPorts are the ports inspected for TLS when none are set
+var DefaultTLSPorts = []int{443, 465, 636, 993, 995, 2376, 6443, 8443}
+
+// DefaultExpiryDays is the number of days before its expiry a certificate is
+// flagged as expiring when none is set
+const DefaultExpiryDays = 30
+
+// tlsVersions are the names of the TLS versions
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// TLSInfo describes the TLS session and certificate of a port
+type TLSInfo struct {
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipher_suite"`
+	Subject     string    `json:"subject"`
+	SANs        []string  `json:"sans,omitempty"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"not_after"`
+	SelfSigned  bool      `json:"self_signed,omitempty"`
+	// Expired certificates are past their NotAfter date, Expiring ones
+	// within the warning days of the scan
+	Expired  bool `json:"expired,omitempty"`
+	Expiring bool `json:"expiring,omitempty"`
+}
+
+// inspectTLS does a TLS handshake with a port of addr, without verifying the
+// certificate so that invalid ones can be described too. The server is asked
+// for the certificate of host unless it is an address. It returns nil if the
+// port does not speak TLS.
+func inspectTLS(ctx context.Context, host, addr string, port int, timeout time.Duration, expiryDays int) *TLSInfo {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: timeout},
+		Config: &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+		},
+	}
+	if net.ParseIP(host) != nil {
+		dialer.Config.ServerName = ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := state.PeerCertificates[0]
+
+	info := &TLSInfo{
+		Version:     tlsVersions[state.Version],
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotAfter:    cert.NotAfter,
+		SelfSigned:  isSelfSigned(cert),
+	}
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+
+	now := time.Now()
+	info.Expired = now.After(cert.NotAfter)
+	info.Expiring = !info.Expired && now.AddDate(0, 0, expiryDays).After(cert.NotAfter)
+	return info
+}
+
+// isSelfSigned reports whether a certificate is signed by its own key, CA or
+// not
+func isSelfSigned(cert *x509.Certificate) bool {
+	if cert.Subject.String() != cert.Issuer.String() {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
@@ -0,0 +1,97 @@
+package scan_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+func TestRunTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	tlsPort := ts.Listener.Addr().(*net.TCPAddr).Port
+
+	// a plain TCP port that never answers the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	plainPort := ln.Addr().(*net.TCPAddr).Port
+
+	cert := ts.Certificate()
+
+	testCases := []struct {
+		name        string
+		opts        scan.Options
+		expTLS      bool
+		expExpiring bool
+	}{
+		{name: "Disabled", opts: scan.Options{TLSPorts: []int{tlsPort, plainPort}}},
+		{name: "NotTLSPort", opts: scan.Options{TLS: true}},
+		{name: "Inspected", opts: scan.Options{TLS: true, TLSPorts: []int{tlsPort, plainPort}},
+			expTLS: true},
+		{name: "Expiring", opts: scan.Options{TLS: true, TLSPorts: []int{tlsPort, plainPort},
+			ExpiryDays: int(time.Until(cert.NotAfter).Hours()/24) + 1},
+			expTLS: true, expExpiring: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hl := &scan.HostsList{}
+			if err := hl.Add("127.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+			tc.opts.Timeout = 200 * time.Millisecond
+
+			res := scan.Run(hl, []int{tlsPort, plainPort}, tc.opts)
+			if len(res) != 1 || len(res[0].PortStates) != 2 {
+				t.Fatalf("expected 1 host with 2 ports, got %+v instead\n", res)
+			}
+			if info := res[0].PortStates[1].TLS; info != nil {
+				t.Errorf("expected no TLS on plain port, got %+v instead\n", info)
+			}
+
+			info := res[0].PortStates[0].TLS
+			if !tc.expTLS {
+				if info != nil {
+					t.Errorf("expected no TLS inspection, got %+v instead\n", info)
+				}
+				return
+			}
+			if info == nil {
+				t.Fatalf("expected TLS inspection, got nil instead\n")
+			}
+
+			if info.Version == "" || info.CipherSuite == "" {
+				t.Errorf("expected version and cipher suite, got %+v instead\n", info)
+			}
+			if info.Subject != cert.Subject.String() || info.Issuer != cert.Issuer.String() {
+				t.Errorf("expected subject %q and issuer %q, got %+v instead\n", cert.Subject, cert.Issuer, info)
+			}
+			if !info.NotAfter.Equal(cert.NotAfter) {
+				t.Errorf("expected expiry %s, got %s instead\n", cert.NotAfter, info.NotAfter)
+			}
+			expSANs := map[string]bool{"example.com": true, "127.0.0.1": true}
+			for _, san := range info.SANs {
+				delete(expSANs, san)
+			}
+			if len(expSANs) != 0 {
+				t.Errorf("expected SANs example.com and 127.0.0.1, got %v instead\n", info.SANs)
+			}
+			if !info.SelfSigned {
+				t.Errorf("expected self-signed certificate")
+			}
+			if info.Expired {
+				t.Errorf("expected certificate not to be expired")
+			}
+			if info.Expiring != tc.expExpiring {
+				t.Errorf("expected expiring %t, got %t instead\n", tc.expExpiring, info.Expiring)
+			}
+		})
+	}
+}
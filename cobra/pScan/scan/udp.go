@@ -0,0 +1,100 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// udpProbes are payloads likely to get an answer from the service usually
+// listening on a UDP port, as most of them ignore unexpected datagrams
+var udpProbes = map[int][]byte{
+	// DNS query for the NS records of the root zone
+	53: {
+		0x70, 0x53, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x02, 0x00, 0x01,
+	},
+	// NTP version 3 client request
+	123: append([]byte{0x1b}, make([]byte, 47)...),
+	// SNMPv1 GetRequest of sysDescr.0 with the public community
+	161: {
+		0x30, 0x29,
+		0x02, 0x01, 0x00,
+		0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1c,
+		0x02, 0x04, 0x70, 0x53, 0x63, 0x6e,
+		0x02, 0x01, 0x00,
+		0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c,
+		0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00,
+		0x05, 0x00,
+	},
+}
+
+// genericUDPProbe is sent to the ports without a specific probe
+var genericUDPProbe = []byte("\r\n\r\n")
+
+// udpProbe returns the probe payload for port
+func udpProbe(port int) []byte {
+	if probe, ok := udpProbes[port]; ok {
+		return probe
+	}
+	return genericUDPProbe
+}
+
+// scanUDPPort sends a probe to a UDP port. The port is open if it answers,
+// closed if the host reports it unreachable and open|filtered if nothing
+// comes back before the timeout.
+func scanUDPPort(ctx context.Context, host string, port int, timeout time.Duration) PortState {
+	p := PortState{
+		Port:     port,
+		Protocol: UDP,
+		Service:  ServiceName(UDP, port),
+		State:    StateClosed,
+	}
+
+	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		p.Reason = errorReason(err)
+		return p
+	}
+	defer conn.Close()
+	defer abortOnCancel(ctx, conn)()
+
+	start := time.Now()
+	if err := conn.SetDeadline(start.Add(timeout)); err != nil {
+		p.Reason = errorReason(err)
+		return p
+	}
+	if _, err := conn.Write(udpProbe(port)); err != nil {
+		p.Reason = errorReason(err)
+		return p
+	}
+
+	// on a connected UDP socket, the ICMP port unreachable reply surfaces as
+	// a refused connection
+	buf := make([]byte, 1024)
+	_, err = conn.Read(buf)
+	switch {
+	case err == nil:
+		p.Latency = time.Since(start)
+		p.State = StateOpen
+		p.Reason = "udp-response"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		p.Latency = time.Since(start)
+		p.State = StateClosed
+		p.Reason = "port-unreach"
+	default:
+		p.State = StateOpenFiltered
+		p.Reason = errorReason(err)
+		if p.Reason == "timeout" {
+			p.Reason = "no-response"
+		}
+	}
+	return p
+}
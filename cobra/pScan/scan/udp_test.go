@@ -0,0 +1,85 @@
+package scan_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/boeboe/learngo/cobra/pScan/scan"
+)
+
+// udpListener starts a local UDP server answering the probes when reply is
+// true, ignoring them otherwise, and returns its port
+func udpListener(t *testing.T, reply bool) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply && n > 0 {
+				conn.WriteTo(buf[:n], addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestRunUDP(t *testing.T) {
+	testCases := []struct {
+		name      string
+		port      func(t *testing.T) int
+		expState  string
+		expReason string
+	}{
+		{name: "OpenPort", expState: "open", expReason: "udp-response",
+			port: func(t *testing.T) int { return udpListener(t, true) }},
+		{name: "SilentPort", expState: "open|filtered", expReason: "no-response",
+			port: func(t *testing.T) int { return udpListener(t, false) }},
+		{name: "ClosedPort", expState: "closed", expReason: "port-unreach",
+			port: func(t *testing.T) int {
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.Close()
+				return conn.LocalAddr().(*net.UDPAddr).Port
+			}},
+	}
+
+	host := "127.0.0.1"
+	hl := &scan.HostsList{}
+	hl.Add(host)
+
+	ports := []int{}
+	for _, tc := range testCases {
+		ports = append(ports, tc.port(t))
+	}
+
+	res := scan.Run(hl, ports, scan.Options{Protocol: scan.UDP, Timeout: 300 * time.Millisecond})
+
+	if len(res) != 1 || len(res[0].PortStates) != len(testCases) {
+		t.Fatalf("expected 1 result with %d port states, got %+v instead", len(testCases), res)
+	}
+	for i, tc := range testCases {
+		ps := res[0].PortStates[i]
+		if ps.Port != ports[i] || ps.Protocol != scan.UDP {
+			t.Errorf("%s: expected port %d/udp, got %d/%s instead", tc.name, ports[i], ps.Port, ps.Protocol)
+		}
+		if ps.State.String() != tc.expState {
+			t.Errorf("%s: expected port %d to be %s, got %s instead", tc.name, ports[i], tc.expState, ps.State)
+		}
+		if ps.Reason != tc.expReason {
+			t.Errorf("%s: expected reason %q, got %q instead", tc.name, tc.expReason, ps.Reason)
+		}
+	}
+}
@@ -17,6 +17,9 @@ func main() {
 	if os.Getenv("TODO_FILENAME") != "" {
 		todoFileName = os.Getenv("TODO_FILENAME")
 	}
+	if os.Getenv("TODO_QUEUE_FILENAME") != "" {
+		queueFileName = os.Getenv("TODO_QUEUE_FILENAME")
+	}
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "%s tool. Developed by boeboe\n", os.Args[0])
@@ -29,8 +32,19 @@ func main() {
 	list := flag.Bool("list", false, "list all tasks")
 	complete := flag.Int("complete", 0, "todo item to complete")
 	delete := flag.Int("delete", 0, "todo item to delete")
+	server := flag.String("server", os.Getenv("TODO_SERVER"), "todoServer URL to use instead of the local file")
+	token := flag.String("token", os.Getenv("TODO_TOKEN"), "bearer token sent to the todoServer")
 	flag.Parse()
 
+	if *server != "" {
+		r := newRemote(*server, *token, queueFileName)
+		if err := runRemote(r, *add, *list, *complete, *delete); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	l := &todo.List{}
 
 	if err := l.Get(todoFileName); err != nil {
@@ -76,6 +90,42 @@ func main() {
 	}
 }
 
+// runRemote performs the requested operation on the server, changes being
+// queued while the server is unreachable
+func runRemote(r *remote, add, list bool, complete, delete int) error {
+	var c change
+	switch {
+	case add:
+		t, err := getTask(os.Stdin, flag.Args()...)
+		if err != nil {
+			return err
+		}
+		c = change{Op: "add", Task: t}
+	case list:
+		l, err := r.list()
+		if err != nil {
+			return err
+		}
+		fmt.Print(&l)
+		return nil
+	case complete > 0:
+		c = change{Op: "complete", ID: complete}
+	case delete > 0:
+		c = change{Op: "delete", ID: delete}
+	default:
+		return fmt.Errorf("invalid option")
+	}
+
+	queued, err := r.apply(c)
+	switch {
+	case queued && err == nil:
+		fmt.Fprintln(os.Stderr, "server unreachable, change queued")
+	case queued:
+		fmt.Fprintln(os.Stderr, "change queued for the next attempt")
+	}
+	return err
+}
+
 func getTask(r io.Reader, args ...string) (string, error) {
 	if len(args) > 0 {
 		return strings.Join(args, " "), nil
@@ -1,13 +1,22 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/boeboe/learngo/interacting/todo"
 )
 
 var (
@@ -122,3 +131,318 @@ func TestTodoCLI(t *testing.T) {
 		}
 	})
 }
+
+// todoAPI is a minimal in-memory todoServer recording the bearer tokens it
+// receives
+type todoAPI struct {
+	mu     sync.Mutex
+	list   todo.List
+	tokens []string
+}
+
+func (a *todoAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens = append(a.tokens, r.Header.Get("Authorization"))
+
+	path := strings.TrimPrefix(r.URL.Path, "/todo")
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(struct {
+			Results todo.List `json:"results"`
+		}{a.list})
+	case path == "" && r.Method == http.MethodPost:
+		var item struct {
+			Task string `json:"task"`
+		}
+		json.NewDecoder(r.Body).Decode(&item)
+		a.list.Add(item.Task)
+		w.WriteHeader(http.StatusCreated)
+	case path == "/batch" && r.Method == http.MethodPost:
+		var batch struct {
+			Operations []struct {
+				Op   string `json:"op"`
+				ID   int    `json:"id"`
+				Task string `json:"task"`
+			} `json:"operations"`
+		}
+		json.NewDecoder(r.Body).Decode(&batch)
+		for _, op := range batch.Operations {
+			switch op.Op {
+			case "add":
+				a.list.Add(op.Task)
+			case "complete":
+				a.list.Complete(op.ID)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			err = a.list.Delete(id)
+		} else {
+			err = a.list.Complete(id)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestTodoCLIRemote(t *testing.T) {
+	task1 := "remote task number 1"
+	task2 := "remote task number 2"
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdPath := filepath.Join(dir, binName)
+	queueFile := filepath.Join(t.TempDir(), "queue.json")
+
+	// reserve an address for the server, down until the queue is tested
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	api := &todoAPI{}
+	env := append(os.Environ(), "TODO_SERVER=http://"+addr,
+		"TODO_TOKEN=secret", "TODO_QUEUE_FILENAME="+queueFile)
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command(cmdPath, args...)
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	t.Run("QueueWhileOffline", func(t *testing.T) {
+		out, err := run("-add", task1)
+		if err != nil {
+			t.Fatalf("%s: %s", err, out)
+		}
+		if !strings.Contains(out, "change queued") {
+			t.Errorf("expected queued change, got %q instead", out)
+		}
+		if _, err := os.Stat(queueFile); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := run("-list"); err == nil {
+			t.Error("expected list to fail while offline")
+		}
+	})
+
+	lis, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(api)
+	ts.Listener.Close()
+	ts.Listener = lis
+	ts.Start()
+	defer ts.Close()
+
+	t.Run("AddFlushesQueue", func(t *testing.T) {
+		if out, err := run("-add", task2); err != nil {
+			t.Fatalf("%s: %s", err, out)
+		}
+		if _, err := os.Stat(queueFile); !os.IsNotExist(err) {
+			t.Errorf("expected queue file to be removed, got %v", err)
+		}
+	})
+
+	t.Run("CompleteTask", func(t *testing.T) {
+		if out, err := run("-complete", "1"); err != nil {
+			t.Fatalf("%s: %s", err, out)
+		}
+
+		out, err := run("-list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("%s(%d) %s\n%s(%d) %s\n", " X ", 1, task1, "   ", 2, task2)
+		if expected != out {
+			t.Errorf("Expected %q, got %q instead\n", expected, out)
+		}
+	})
+
+	t.Run("DeleteTask", func(t *testing.T) {
+		if out, err := run("-delete", "1"); err != nil {
+			t.Fatalf("%s: %s", err, out)
+		}
+		if _, err := run("-delete", "5"); err == nil {
+			t.Error("expected error deleting a missing item")
+		}
+
+		out, err := run("-list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("%s(%d) %s\n", "   ", 1, task2)
+		if expected != out {
+			t.Errorf("Expected %q, got %q instead\n", expected, out)
+		}
+	})
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	for _, token := range api.tokens {
+		if token != "Bearer secret" {
+			t.Errorf("expected bearer token, got %q instead", token)
+		}
+	}
+}
+
+func TestTodoCLIRemoteQueueKept(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdPath := filepath.Join(dir, binName)
+
+	testCases := []struct {
+		name     string
+		status   int
+		expQueue bool
+	}{
+		{name: "RateLimited", status: http.StatusTooManyRequests, expQueue: true},
+		{name: "ServerError", status: http.StatusInternalServerError, expQueue: true},
+		{name: "Unauthorized", status: http.StatusUnauthorized, expQueue: true},
+		{name: "Forbidden", status: http.StatusForbidden, expQueue: true},
+		{name: "Rejected", status: http.StatusBadRequest, expQueue: false},
+		{name: "TooLarge", status: http.StatusRequestEntityTooLarge, expQueue: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(tc.status), tc.status)
+			}))
+			defer ts.Close()
+
+			queueFile := filepath.Join(t.TempDir(), "queue.json")
+			if err := os.WriteFile(queueFile, []byte(`[{"op":"add","task":"queued task"}]`), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(cmdPath, "-list")
+			cmd.Env = append(os.Environ(), "TODO_SERVER="+ts.URL, "TODO_QUEUE_FILENAME="+queueFile)
+			if out, err := cmd.CombinedOutput(); err == nil {
+				t.Errorf("expected list to fail, got %q instead", out)
+			}
+
+			_, err := os.Stat(queueFile)
+			if tc.expQueue && err != nil {
+				t.Errorf("expected queue file to be kept, got %v", err)
+			}
+			if !tc.expQueue && !os.IsNotExist(err) {
+				t.Errorf("expected queue file to be dropped, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTodoCLIRemoteBatch(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdPath := filepath.Join(dir, binName)
+
+	type operation struct {
+		Op   string `json:"op"`
+		ID   int    `json:"id"`
+		Task string `json:"task"`
+	}
+	var mu sync.Mutex
+	var batches [][]operation
+	// the server rejects the batches completing item 5, which does not exist
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch struct {
+			Operations []operation `json:"operations"`
+		}
+		json.NewDecoder(r.Body).Decode(&batch)
+		mu.Lock()
+		batches = append(batches, batch.Operations)
+		mu.Unlock()
+
+		type result struct {
+			Status int    `json:"status"`
+			Error  string `json:"error,omitempty"`
+		}
+		results := []result{}
+		status := http.StatusOK
+		for _, op := range batch.Operations {
+			if op.Op == "complete" && op.ID == 5 {
+				results = append(results, result{http.StatusNotFound, "ID 5 not found"})
+				status = http.StatusBadRequest
+				continue
+			}
+			results = append(results, result{Status: http.StatusFailedDependency})
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Results []result `json:"results"`
+		}{results})
+	}))
+	defer ts.Close()
+
+	testCases := []struct {
+		name       string
+		queue      string
+		args       []string
+		expBatches [][]operation
+		expOut     string
+	}{
+		{name: "ChangeInQueueBatch", queue: `[{"op":"delete","id":1}]`, args: []string{"-complete", "3"},
+			expBatches: [][]operation{{{Op: "delete", ID: 1}, {Op: "complete", ID: 3}}}},
+		{name: "InvalidDropped", queue: `[{"op":"add","task":"queued task"},{"op":"complete","id":5}]`,
+			args: []string{"-delete", "2"},
+			expBatches: [][]operation{
+				{{Op: "add", Task: "queued task"}, {Op: "complete", ID: 5}, {Op: "delete", ID: 2}},
+				{{Op: "add", Task: "queued task"}, {Op: "delete", ID: 2}},
+			},
+			expOut: "dropped change complete 5: ID 5 not found"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			batches = nil
+			mu.Unlock()
+
+			queueFile := filepath.Join(t.TempDir(), "queue.json")
+			if err := os.WriteFile(queueFile, []byte(tc.queue), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(cmdPath, tc.args...)
+			cmd.Env = append(os.Environ(), "TODO_SERVER="+ts.URL, "TODO_QUEUE_FILENAME="+queueFile)
+			out, err := cmd.CombinedOutput()
+			if tc.expOut == "" && err != nil {
+				t.Fatalf("%s: %s", err, out)
+			}
+			if !strings.Contains(string(out), tc.expOut) {
+				t.Errorf("expected output %q, got %q instead", tc.expOut, out)
+			}
+			if _, err := os.Stat(queueFile); !os.IsNotExist(err) {
+				t.Errorf("expected queue file to be removed, got %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if fmt.Sprint(batches) != fmt.Sprint(tc.expBatches) {
+				t.Errorf("expected batches %v, got %v instead", tc.expBatches, batches)
+			}
+		})
+	}
+}
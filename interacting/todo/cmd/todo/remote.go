@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boeboe/learngo/interacting/todo"
+)
+
+var queueFileName = ".todo.queue.json"
+
+// ErrOffline is returned when the server cannot be reached
+var ErrOffline = errors.New("server unreachable")
+
+// statusError is the unexpected status of a response from the server
+type statusError struct {
+	method, path string
+	code         int
+	status       string
+	body         []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.method, e.path, e.status)
+}
+
+// change is a change of the list waiting for the server to come back, in the
+// operation format of the todoServer batch endpoint
+type change struct {
+	Op   string `json:"op"`
+	ID   int    `json:"id,omitempty"`
+	Task string `json:"task,omitempty"`
+}
+
+func (c change) String() string {
+	if c.Op == "add" {
+		return fmt.Sprintf("add %q", c.Task)
+	}
+	return fmt.Sprintf("%s %d", c.Op, c.ID)
+}
+
+// remote performs the todo operations on a todoServer instead of a local file
+type remote struct {
+	url    string
+	token  string
+	queue  string
+	client *http.Client
+	// warn receives the changes dropped from the queue
+	warn io.Writer
+}
+
+func newRemote(url, token, queue string) *remote {
+	return &remote{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		queue:  queue,
+		client: &http.Client{Timeout: 10 * time.Second},
+		warn:   os.Stderr,
+	}
+}
+
+// do sends a request to the todo API and checks its status, wrapping network
+// errors with ErrOffline
+func (r *remote) do(method, path string, body interface{}, expStatus int) (*http.Response, error) {
+	var content io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		content = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, r.url+path, content)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrOffline, err)
+	}
+	if resp.StatusCode != expStatus {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		return nil, &statusError{method, path, resp.StatusCode, resp.Status, body}
+	}
+	return resp, nil
+}
+
+func (r *remote) list() (todo.List, error) {
+	if err := r.flush(); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.do(http.MethodGet, "/todo", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content struct {
+		Results todo.List `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&content); err != nil {
+		return nil, err
+	}
+	return content.Results, nil
+}
+
+// apply sends a change to the server, queuing it when the server cannot be
+// reached. A change made while changes are queued is queued with them and
+// sent in the same batch, its item number referring to the same list as
+// theirs. It reports whether the change was left queued.
+func (r *remote) apply(c change) (bool, error) {
+	changes, err := r.queued()
+	if err != nil {
+		return false, err
+	}
+	if len(changes) > 0 {
+		if err := r.save(append(changes, c)); err != nil {
+			return false, err
+		}
+		err := r.flush()
+		if errors.Is(err, ErrOffline) {
+			return true, nil
+		}
+		left, qerr := r.queued()
+		return err != nil && qerr == nil && len(left) > 0, err
+	}
+
+	err = r.send(c)
+	if !errors.Is(err, ErrOffline) {
+		return false, err
+	}
+	if err := r.enqueue(c); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *remote) send(c change) error {
+	var resp *http.Response
+	var err error
+
+	switch c.Op {
+	case "add":
+		resp, err = r.do(http.MethodPost, "/todo", struct {
+			Task string `json:"task"`
+		}{c.Task}, http.StatusCreated)
+	case "complete":
+		resp, err = r.do(http.MethodPatch, fmt.Sprintf("/todo/%d?complete", c.ID), nil, http.StatusNoContent)
+	case "delete":
+		resp, err = r.do(http.MethodDelete, fmt.Sprintf("/todo/%d", c.ID), nil, http.StatusNoContent)
+	default:
+		return fmt.Errorf("unknown operation %q", c.Op)
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (r *remote) queued() ([]change, error) {
+	var changes []change
+	file, err := os.ReadFile(r.queue)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(file) == 0 {
+		return nil, nil
+	}
+	return changes, json.Unmarshal(file, &changes)
+}
+
+func (r *remote) enqueue(c change) error {
+	changes, err := r.queued()
+	if err != nil {
+		return err
+	}
+	return r.save(append(changes, c))
+}
+
+// save replaces the queued changes, removing the queue once empty
+func (r *remote) save(changes []change) error {
+	if len(changes) == 0 {
+		err := os.Remove(r.queue)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	js, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.queue, js, 0644)
+}
+
+// flush sends the queued changes in a single batch
+func (r *remote) flush() error {
+	changes, err := r.queued()
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	return r.sendBatch(changes)
+}
+
+// sendBatch sends changes in a single batch, the item numbers of all of them
+// referring to the list as it was before the first one, which is the last
+// list the user could see. The queue is kept as it is on any failure that may
+// not happen again, such as throttling, server errors or a refused token, for
+// the next attempt. When the server rejects some of the changes, those are
+// dropped and the valid ones queued and sent again. A batch the server
+// rejects as a whole, such as one too large, is dropped as it would be
+// rejected again. The dropped changes are reported to r.warn.
+func (r *remote) sendBatch(changes []change) error {
+	dropped := 0
+	for len(changes) > 0 {
+		resp, err := r.do(http.MethodPost, "/todo/batch", struct {
+			Operations []change `json:"operations"`
+		}{changes}, http.StatusOK)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+
+		var se *statusError
+		if !errors.As(err, &se) || !rejected(se.code) {
+			return err
+		}
+		valid := r.drop(changes, se)
+		dropped += len(changes) - len(valid)
+		if err := r.save(valid); err != nil {
+			return err
+		}
+		changes = valid
+	}
+
+	if err := r.save(nil); err != nil {
+		return err
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%d changes rejected by the server and dropped", dropped)
+	}
+	return nil
+}
+
+// rejected reports whether a batch failing with code would be rejected again
+func rejected(code int) bool {
+	return code == http.StatusBadRequest || code == http.StatusNotFound ||
+		code == http.StatusRequestEntityTooLarge
+}
+
+// drop returns the changes of a rejected batch the server found valid,
+// reporting the others, or all of them when the server does not tell which
+// ones are valid
+func (r *remote) drop(changes []change, se *statusError) []change {
+	var content struct {
+		Results []struct {
+			Status int    `json:"status"`
+			Error  string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(se.body, &content); err != nil || len(content.Results) != len(changes) {
+		for _, c := range changes {
+			fmt.Fprintf(r.warn, "dropped change %s: %s\n", c, se.status)
+		}
+		return nil
+	}
+
+	var valid []change
+	for i, res := range content.Results {
+		if res.Status == http.StatusFailedDependency {
+			valid = append(valid, changes[i])
+			continue
+		}
+		fmt.Fprintf(r.warn, "dropped change %s: %s\n", changes[i], res.Error)
+	}
+	return valid
+}